@@ -0,0 +1,203 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/urfave/cli"
+)
+
+// isArchived returns true if the filename, relative to the migrations path, is in the archive folder.
+func isArchived(filename string) bool {
+	return strings.HasPrefix(filename, defaultArchiveFolder+"/")
+}
+
+// archivedMigrationFiles returns the filenames, relative to the migrations path, of all migrations in the archive folder.
+func archivedMigrationFiles(migrationsPath string) ([]string, error) {
+	if checkExists(filepath.Join(migrationsPath, defaultArchiveFolder)) != nil {
+		return []string{}, nil
+	}
+	return collectMigrationFiles(migrationsPath, []string{defaultArchiveFolder})
+}
+
+// archiveMigrations moves the migrations into the archive folder, keeping their folder.
+func archiveMigrations(migrationsPath string, filenames []string) error {
+	for _, each := range filenames {
+		archived := filepath.Join(migrationsPath, defaultArchiveFolder, each)
+		if err := os.MkdirAll(filepath.Dir(archived), os.ModePerm); err != nil {
+			return err
+		}
+		if err := os.Rename(filepath.Join(migrationsPath, each), archived); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// migrationFiles returns the filenames of all migrations that are listed for the target.
+// Archived migrations that the target has not applied are included, e.g. all of them for a new target,
+// except those that are squashed into a baseline, which replaces them.
+func (m migrationContext) migrationFiles() ([]string, error) {
+	filenames, err := collectMigrationFiles(m.migrationsPath, m.config().Migrations)
+	if err != nil {
+		return nil, err
+	}
+	archived, err := archivedMigrationFiles(m.migrationsPath)
+	if err != nil {
+		return nil, err
+	}
+	pending := []string{}
+	for _, each := range archived {
+		if sortsBefore(m.lastApplied, each) {
+			pending = append(pending, each)
+		}
+	}
+	if len(pending) == 0 {
+		return filenames, nil
+	}
+	squashed, err := squashedNames(m.migrationsPath, append(append([]string{}, filenames...), archived...))
+	if err != nil {
+		return nil, err
+	}
+	for _, each := range pending {
+		if !squashed[migrationName(each)] {
+			filenames = append(filenames, each)
+		}
+	}
+	sort.Slice(filenames, func(i, j int) bool {
+		return sortsBefore(filenames[i], filenames[j])
+	})
+	return filenames, nil
+}
+
+// squashedNames returns the names of the migrations that are replaced by one of the baselines.
+func squashedNames(migrationsPath string, filenames []string) (map[string]bool, error) {
+	names := map[string]bool{}
+	for _, each := range filenames {
+		m, err := LoadMigration(filepath.Join(migrationsPath, each))
+		if err != nil {
+			return nil, err
+		}
+		for _, other := range m.Squashed {
+			names[migrationName(other)] = true
+		}
+	}
+	return names, nil
+}
+
+// archivedNames returns the names of all archived migrations, such that they can be required by others.
+func (m migrationContext) archivedNames() ([]string, error) {
+	archived, err := archivedMigrationFiles(m.migrationsPath)
+	if err != nil {
+		return nil, err
+	}
+	names := []string{}
+	for _, each := range archived {
+		names = append(names, migrationName(each))
+	}
+	return names, nil
+}
+
+// archivedBefore returns the filename of the last archived migration before the given one ; empty if there is none.
+func (m migrationContext) archivedBefore(filename string) (string, error) {
+	archived, err := archivedMigrationFiles(m.migrationsPath)
+	if err != nil {
+		return "", err
+	}
+	last := ""
+	for _, each := range archived {
+		if sortsBefore(each, filename) {
+			last = each
+		}
+	}
+	return last, nil
+}
+
+// appliedBefore returns the filename of the migration that is applied before the last of all, which are listed ; empty if there is none.
+// For a baseline, that is the migration before the first one it has squashed.
+func (m migrationContext) appliedBefore(all []Migration) (string, error) {
+	last := all[len(all)-1]
+	first := last.Filename
+	if len(last.Squashed) > 0 {
+		first = last.Squashed[0]
+	}
+	previous, err := m.archivedBefore(first)
+	if err != nil {
+		return "", err
+	}
+	for _, each := range all[:len(all)-1] {
+		if sortsBefore(each.Filename, first) && sortsBefore(previous, each.Filename) {
+			previous = each.Filename
+		}
+	}
+	return previous, nil
+}
+
+// countArchived returns the number of migrations from the archive folder.
+func countArchived(list []Migration) (count int) {
+	for _, each := range list {
+		if isArchived(each.Filename) {
+			count++
+		}
+	}
+	return
+}
+
+func cmdArchive(c *cli.Context) error {
+	mtx, err := getMigrationContext(c)
+	if err != nil {
+		printError(err.Error())
+		return errAbort
+	}
+	before := c.String("before")
+	if len(before) == 0 {
+		printError("missing --before with the filename of the first migration to keep")
+		return errAbort
+	}
+	if before, err = mtx.migrationFile(before); err != nil {
+		printError(err.Error())
+		return errAbort
+	}
+	all, err := collectMigrationFiles(mtx.migrationsPath, mtx.config().Migrations)
+	if err != nil {
+		printError(err.Error())
+		return errAbort
+	}
+	archiving := []string{}
+	for _, each := range all {
+		if sortsBefore(each, before) {
+			archiving = append(archiving, each)
+		}
+	}
+	if len(archiving) == 0 {
+		log.Printf("no migrations before [%s] to archive\n", before)
+		return nil
+	}
+	if last := archiving[len(archiving)-1]; sortsBefore(mtx.lastApplied, last) {
+		printError(fmt.Sprintf("target [%s] has not applied [%s], last applied is [%s]", mtx.target(), last, mtx.lastApplied))
+		return errAbort
+	}
+	for _, each := range archiving {
+		fmt.Printf("%s -> %s\n", each, path.Join(defaultArchiveFolder, each))
+	}
+	if !c.Bool("apply") {
+		log.Printf("dry run, use --apply to archive %d migration(s)\n", len(archiving))
+		return nil
+	}
+	if !c.GlobalBool("q") {
+		if !promptForYes(fmt.Sprintf("Are you sure to archive %d migration(s) (y/N)? ", len(archiving))) {
+			return errAbort
+		}
+	}
+	if err := archiveMigrations(mtx.migrationsPath, archiving); err != nil {
+		printError(err.Error())
+		return errAbort
+	}
+	log.Printf("archived %d migration(s) into [%s]\n", len(archiving), defaultArchiveFolder)
+	return nil
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func archiveTestContext(t *testing.T, lastApplied string) migrationContext {
+	dir := t.TempDir()
+	writeTestFiles(t, dir, "archive/010_one.yaml", "archive/iam/020_two.yaml", "030_three.yaml")
+	return migrationContext{
+		stateProvider:  NewFileStateProvider(Config{Project: "demo"}),
+		migrationsPath: dir,
+		lastApplied:    lastApplied,
+	}
+}
+
+func TestMigrationFileInArchive(t *testing.T) {
+	mtx := archiveTestContext(t, "")
+	got, err := mtx.migrationFile("iam/020_two.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "archive/iam/020_two.yaml"; got != want {
+		t.Errorf("got [%v] want [%v]", got, want)
+	}
+}
+
+func TestMigrationFilesWithPendingArchived(t *testing.T) {
+	mtx := archiveTestContext(t, "archive/010_one.yaml")
+	list, err := mtx.migrationFiles()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := strings.Join(list, ","), "archive/iam/020_two.yaml,030_three.yaml"; got != want {
+		t.Errorf("got [%v] want [%v]", got, want)
+	}
+	mtx.lastApplied = "030_three.yaml"
+	list, _ = mtx.migrationFiles()
+	if got, want := strings.Join(list, ","), "030_three.yaml"; got != want {
+		t.Errorf("got [%v] want [%v]", got, want)
+	}
+	// new target
+	mtx.lastApplied = ""
+	list, _ = mtx.migrationFiles()
+	if got, want := strings.Join(list, ","), "archive/010_one.yaml,archive/iam/020_two.yaml,030_three.yaml"; got != want {
+		t.Errorf("got [%v] want [%v]", got, want)
+	}
+}
+
+func TestMigrationFilesWithoutSquashed(t *testing.T) {
+	mtx := archiveTestContext(t, "")
+	baseline := "squashed:\n- 010_one.yaml\n- iam/020_two.yaml\ndo:\n- echo baseline"
+	if err := os.WriteFile(filepath.Join(mtx.migrationsPath, "020_baseline.yaml"), []byte(baseline), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	list, err := mtx.migrationFiles()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := strings.Join(list, ","), "020_baseline.yaml,030_three.yaml"; got != want {
+		t.Errorf("got [%v] want [%v]", got, want)
+	}
+}
+
+func TestValidateRequirementsArchived(t *testing.T) {
+	all := []Migration{{Filename: "030_three.yaml", Requires: []string{"020_two.yaml"}}}
+	if err := validateRequirements(all); err == nil {
+		t.Error("expected error")
+	}
+	if err := validateRequirements(all, "010_one.yaml", "020_two.yaml"); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestArchiveMigrations(t *testing.T) {
+	mtx := archiveTestContext(t, "")
+	writeTestFiles(t, mtx.migrationsPath, "iam/040_four.yaml")
+	if err := archiveMigrations(mtx.migrationsPath, []string{"030_three.yaml", "iam/040_four.yaml"}); err != nil {
+		t.Fatal(err)
+	}
+	archived, err := archivedMigrationFiles(mtx.migrationsPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := strings.Join(archived, ","), "archive/010_one.yaml,archive/iam/020_two.yaml,archive/030_three.yaml,archive/iam/040_four.yaml"; got != want {
+		t.Errorf("got [%v] want [%v]", got, want)
+	}
+}
+
+func TestArchivedBefore(t *testing.T) {
+	mtx := archiveTestContext(t, "")
+	got, err := mtx.archivedBefore("030_three.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "archive/iam/020_two.yaml"; got != want {
+		t.Errorf("got [%v] want [%v]", got, want)
+	}
+	if got, _ := mtx.archivedBefore("010_one.yaml"); got != "" {
+		t.Errorf("got [%v] want empty", got)
+	}
+}
+
+func TestAppliedBefore(t *testing.T) {
+	mtx := archiveTestContext(t, "")
+	all := []Migration{{Filename: "archive/010_one.yaml"}, {Filename: "archive/iam/020_two.yaml"}}
+	if got, _ := mtx.appliedBefore(all); got != "archive/010_one.yaml" {
+		t.Errorf("got [%v] want [%v]", got, "archive/010_one.yaml")
+	}
+	if got, _ := mtx.appliedBefore([]Migration{{Filename: "030_three.yaml"}}); got != "archive/iam/020_two.yaml" {
+		t.Errorf("got [%v] want [%v]", got, "archive/iam/020_two.yaml")
+	}
+	// baseline that has squashed all archived migrations
+	baseline := []Migration{{Filename: "020_baseline.yaml", Squashed: []string{"010_one.yaml", "iam/020_two.yaml"}}}
+	if got, _ := mtx.appliedBefore(baseline); got != "" {
+		t.Errorf("got [%v] want empty", got)
+	}
+}
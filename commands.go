@@ -1,6 +1,7 @@
 package main
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
 	"log"
@@ -23,10 +24,12 @@ const (
 	execUndo            = "...    undo ..."
 	execPlan            = "...    plan ..."
 	stopped             = "... stopped ..."
+	blocked             = "... blocked ..."
 	skipped             = "--- skipped ---"
 	skipping            = "... skipping .."
 	conditionErrored    = "--- if error --"
 	conditionError      = "... if error .."
+	archivedStatus      = "-- archived ---"
 )
 
 func cmdCreateMigration(c *cli.Context) error {
@@ -36,11 +39,23 @@ func cmdCreateMigration(c *cli.Context) error {
 		printError("missing migration title")
 		return errAbort
 	}
-	filename := NewFilenameWithIndex(desc)
+	migrationsPath, cfg, err := newMigrationSettings(c)
+	if err != nil {
+		printError(err.Error())
+		return errAbort
+	}
+	filename, err := newMigrationFilename(migrationsPath, cfg.Migrations, cfg.Naming, desc)
+	if err != nil {
+		printError(err.Error())
+		return errAbort
+	}
+	warnBranchCollisions(migrationsPath, filename)
 	defaultCommands := []string{"gcloud config list"}
 	doSection, undoSection, viewSection := defaultCommands, defaultCommands, []string{}
 	if doValue := c.String("do"); len(doValue) > 0 {
 		doSection = strings.Split(doValue, "\n")
+		// propose the inverse of recognised commands
+		undoSection, viewSection = proposeUndoAndView(append(append([]UndoRule{}, undoRules...), cfg.UndoRules...), doSection)
 	}
 	if undoValue := c.String("undo"); len(undoValue) > 0 {
 		undoSection = strings.Split(undoValue, "\n")
@@ -50,17 +65,73 @@ func cmdCreateMigration(c *cli.Context) error {
 	}
 	m := Migration{
 		Description: desc,
+		Owner:       c.String("owner"),
+		Ticket:      c.String("ticket"),
 		Filename:    filename,
 		DoSection:   doSection,
 		UndoSection: undoSection,
 		ViewSection: viewSection,
 	}
+	if name := c.String("template"); len(name) > 0 {
+		return createMigrationFromTemplate(c, name, m, migrationsPath, cfg)
+	}
 	yaml, err := m.ToYAML()
 	if err != nil {
 		printError("YAML creation failed")
 		return errAbort
 	}
-	return os.WriteFile(filename, []byte(yaml), os.FileMode(0644)) // -rw-r--r--, see http://permissions-calculator.org/
+	return os.WriteFile(filepath.Join(migrationsPath, filename), []byte(yaml), os.FileMode(0644)) // -rw-r--r--, see http://permissions-calculator.org/
+}
+
+// newMigrationSettings returns the folder for a new migration and the configuration, if given by the config flag.
+func newMigrationSettings(c *cli.Context) (migrationsPath string, cfg Config, err error) {
+	migrationsPath = "."
+	if pathToConfig := c.String("config"); len(pathToConfig) > 0 {
+		loaded, lerr := TryToLoadConfig(pathToConfig)
+		if lerr != nil {
+			return "", cfg, lerr
+		}
+		cfg = *loaded
+		abs, aerr := filepath.Abs(pathToConfig)
+		if aerr != nil {
+			return "", cfg, aerr
+		}
+		migrationsPath = filepath.Dir(abs)
+	}
+	if folder := c.String("migrations"); len(folder) > 0 {
+		migrationsPath = folder
+	}
+	if strategy := c.String("naming"); len(strategy) > 0 {
+		cfg.Naming.Strategy = strategy
+	}
+	return
+}
+
+// createMigrationFromTemplate writes a new migration using one of the templates of the project.
+func createMigrationFromTemplate(c *cli.Context, name string, m Migration, migrationsPath string, cfg Config) error {
+	folder := cfg.Templates
+	if len(folder) == 0 {
+		folder = defaultTemplatesFolder
+	}
+	source, err := findMigrationTemplate(filepath.Join(migrationsPath, folder), name)
+	if err != nil {
+		printError(err.Error())
+		return errAbort
+	}
+	values, err := parseSetValues(c.StringSlice("set"))
+	if err != nil {
+		printError(err.Error())
+		return errAbort
+	}
+	if isMarkdownFile(source) {
+		m.Filename = strings.TrimSuffix(m.Filename, filepath.Ext(m.Filename)) + ".md"
+	}
+	content, err := renderMigrationTemplate(source, m, values)
+	if err != nil {
+		printError(err.Error())
+		return errAbort
+	}
+	return os.WriteFile(filepath.Join(migrationsPath, m.Filename), content, os.FileMode(0644))
 }
 
 func cmdMigrationsUp(c *cli.Context) error {
@@ -78,53 +149,130 @@ func runMigrations(c *cli.Context, isLogOnly bool) error {
 		return errAbort
 	}
 	stopAfter := c.Args().Get(1) // empty if not specified
-	all, err := LoadMigrationsBetweenAnd(mtx.migrationsPath, mtx.lastApplied, stopAfter)
+	all, err := mtx.loadMigrationsBetweenAnd(mtx.lastApplied, stopAfter)
 	if err != nil {
 		printError(err.Error())
 		return errAbort
 	}
+	everything, err := mtx.loadMigrationsBetweenAnd("", "")
+	if err != nil {
+		printError(err.Error())
+		return errAbort
+	}
+	archived, err := mtx.archivedNames()
+	if err != nil {
+		printError(err.Error())
+		return errAbort
+	}
+	if err := validateRequirements(everything, archived...); err != nil {
+		printError(err.Error())
+		return errAbort
+	}
+	if err := checkNotInSquashed(mtx.lastApplied, all); err != nil {
+		printError(err.Error())
+		return errAbort
+	}
 	// if stopAfter is specified then it must be one of all
 	found := false
 	for _, each := range all {
-		if stopAfter == each.Filename {
+		if sameMigration(stopAfter, each.Filename) {
 			found = true
 			break
 		}
 	}
 	envs := mtx.shellEnv()
 	// if lastApplied is after stopAfter then it is also not found but then we don't care
-	if !found && stopAfter > mtx.lastApplied {
+	if !found && len(stopAfter) > 0 && sortsBefore(mtx.lastApplied, stopAfter) {
 		reportError(mtx.stateProvider.Config(), envs, "up until stop", errors.New("No such migration file: "+stopAfter))
 		return errAbort
 	}
 	prettyWidth := largestWidthOf(all)
+	filter := newTagFilter(c)
 	for _, each := range all {
+		envs := mtx.migrationEnv(each, "do")
+		if !filter.isIncluded(each) {
+			// the state cannot move past a migration that is not applied
+			log.Println(statusSeparator)
+			log.Printf("%s %-"+strconv.Itoa(prettyWidth)+"s (%s) has none of the tags %v\n", stopped, pretty(each.Filename), each.Filename, filter.include)
+			log.Println(statusSeparator)
+			break
+		}
+		if filter.isExcluded(each) {
+			// same as a migration with a false condition
+			log.Println(statusSeparator)
+			log.Printf("%s %-"+strconv.Itoa(prettyWidth)+"s (%s) has one of the excluded tags %v\n", skipping, pretty(each.Filename), each.Filename, filter.exclude)
+			if !isLogOnly {
+				mtx.lastApplied = each.Filename
+				if err := mtx.saveState(); err != nil {
+					reportError(mtx.stateProvider.Config(), envs, "save state", err)
+					return errAbort
+				}
+			}
+			if sameMigration(stopAfter, each.Filename) {
+				log.Println(stopped)
+				log.Println(statusSeparator)
+				break
+			}
+			continue
+		}
 		log.Println(statusSeparator)
 		leadingTitle := execDo
 		if isLogOnly {
 			leadingTitle = execPlan
 		}
-		log.Printf("%s %-"+strconv.Itoa(prettyWidth)+"s (%s)\n", leadingTitle, pretty(each.Filename), each.Filename)
+		log.Printf("%s %-"+strconv.Itoa(prettyWidth)+"s (%s)%s\n", leadingTitle, pretty(each.Filename), each.Filename, each.variantInfo())
 		if isLogOnly {
+			each.logDetails()
 			log.Println("")
-			if LogAll(each.IfExpression, each.DoSection, envs, true) != nil {
+			if len(each.PrecheckSection) > 0 {
+				log.Println("precheck:")
+				if err := forEachRun(each, "precheck", envs, func(runEnvs []string) error {
+					return LogAll(mtx.condition(each), each.PrecheckSection, runEnvs, true)
+				}); err != nil {
+					reportError(mtx.stateProvider.Config(), envs, "plan precheck", err)
+					return errAbort
+				}
+				log.Println("do:")
+			}
+			if err := forEachRun(each, "do", envs, func(runEnvs []string) error {
+				return LogAll(mtx.condition(each), each.DoSection, runEnvs, true)
+			}); err != nil {
 				reportError(mtx.stateProvider.Config(), envs, "plan do", err)
 				return errAbort
 			}
 		} else {
-			if err := ExecuteAll(each.IfExpression, each.DoSection, envs, c.GlobalBool("v")); err != nil {
+			// prepare again because it may use outputs of migrations applied in this run
+			if each, err = mtx.loadMigration(each.Filename); err != nil {
+				reportError(mtx.stateProvider.Config(), envs, "load", err)
+				return errAbort
+			}
+			if err := mtx.checkRequirementsApplied(each, everything); err != nil {
+				reportError(mtx.stateProvider.Config(), envs, "check requires", err)
+				return errAbort
+			}
+			if err := checkPreconditions(each, mtx.condition(each), envs, c.GlobalBool("v")); err != nil {
+				reportBlocked(each, err)
+				return errAbort
+			}
+			outputs, err := executeDo(each, mtx.condition(each), envs, c.GlobalBool("v"))
+			if err != nil {
 				reportError(mtx.stateProvider.Config(), envs, "do", err)
 				return errAbort
 			}
 			mtx.lastApplied = each.Filename
+			mtx.skipped = append(withoutSkippedOf(mtx.skipped, each.Filename), skippedProbes(mtx.probes, each.Filename)...)
+			mtx.history = mtx.appendHistory(newHistoryEntry(each, "do"))
+			if len(outputs) > 0 {
+				mtx.outputs[each.Filename] = outputs
+			}
 			// save after each succesful migration
-			if err := mtx.stateProvider.SaveState(mtx.lastApplied); err != nil {
+			if err := mtx.saveState(); err != nil {
 				reportError(mtx.stateProvider.Config(), envs, "save state", err)
 				return errAbort
 			}
 		}
 		// if not empty then stop after applying this migration
-		if stopAfter == each.Filename {
+		if sameMigration(stopAfter, each.Filename) {
 			log.Println(stopped)
 			log.Println(statusSeparator)
 			break
@@ -143,7 +291,7 @@ func cmdMigrationsDownAll(c *cli.Context) error {
 		return errAbort
 	}
 	//get all applied migrations
-	all, err := LoadMigrationsBetweenAnd(".", "", mtx.lastApplied)
+	all, err := mtx.loadMigrationsBetweenAnd("", mtx.lastApplied)
 	if err != nil {
 		printError(err.Error())
 		return errAbort
@@ -167,32 +315,59 @@ func cmdMigrationsDown(c *cli.Context) error {
 		printWarning("There are no migrations to undo")
 		return errAbort
 	}
-	all, err := LoadMigrationsBetweenAnd(mtx.migrationsPath, "", mtx.lastApplied)
+	if isArchived(mtx.lastApplied) {
+		printError(fmt.Sprintf("last applied migration [%s] is archived and cannot be undone", mtx.lastApplied))
+		return errAbort
+	}
+	all, err := mtx.loadMigrationsBetweenAnd("", mtx.lastApplied)
 	if err != nil {
 		printError(err.Error())
 		return errAbort
 	}
 	lastMigration := all[len(all)-1]
+	if err := mtx.checkNotRequired(lastMigration, all); err != nil {
+		printError(err.Error())
+		return errAbort
+	}
 	log.Println(statusSeparator)
 	log.Println(execUndo, pretty(mtx.lastApplied))
 	log.Println(statusSeparator)
-	envs := mtx.shellEnv()
-	if err := ExecuteAll(lastMigration.IfExpression, lastMigration.UndoSection, envs, c.GlobalBool("v")); err != nil {
+	envs := mtx.migrationEnv(lastMigration, "undo")
+	if err := checkPreconditions(lastMigration, mtx.undoCondition(lastMigration), envs, c.GlobalBool("v")); err != nil {
+		reportBlocked(lastMigration, err)
+		return errAbort
+	}
+	if err := forEachRun(lastMigration, "undo", envs, func(runEnvs []string) error {
+		return ExecuteAll(mtx.undoCondition(lastMigration), lastMigration.UndoSection, runEnvs, c.GlobalBool("v"))
+	}); err != nil {
 		reportError(mtx.stateProvider.Config(), envs, "undo", err)
 		return errAbort
 	}
 	// save after succesful migration
-	previousFilename := ""
-	if len(all) > 1 {
-		previousFilename = all[len(all)-2].Filename
+	previousFilename, err := mtx.appliedBefore(all)
+	if err != nil {
+		printError(err.Error())
+		return errAbort
 	}
-	if err := mtx.stateProvider.SaveState(previousFilename); err != nil {
+	mtx.lastApplied = previousFilename
+	mtx.history = mtx.appendHistory(newHistoryEntry(lastMigration, "undo"))
+	mtx.outputs = withoutOutputsOf(mtx.outputs, lastMigration.Filename)
+	mtx.skipped = withoutSkippedOf(mtx.skipped, lastMigration.Filename)
+	if err := mtx.saveState(); err != nil {
 		reportError(mtx.stateProvider.Config(), envs, "save state", err)
 		return errAbort
 	}
 	return nil
 }
 
+// reportBlocked logs that a migration was not executed because its precheck failed.
+func reportBlocked(m Migration, err error) {
+	log.Println(statusSeparator)
+	log.Println(blocked, pretty(m.Filename))
+	log.Println(statusSeparator)
+	printWarning(err.Error())
+}
+
 func largestWidthOf(list []Migration) int {
 	prettyWidth := 0
 	for _, each := range list {
@@ -210,18 +385,55 @@ func cmdMigrationsStatus(c *cli.Context) error {
 		printError(err.Error())
 		return errAbort
 	}
-	all, err := LoadMigrationsBetweenAnd(mtx.migrationsPath, "", "")
+	all, err := mtx.loadMigrationsBetweenAnd("", "")
 	if err != nil {
 		printError(err.Error())
 		return errAbort
 	}
-	log.Println(statusSeparator)
-	envs := mtx.shellEnv()
+	archived, err := mtx.archivedNames()
+	if err != nil {
+		printError(err.Error())
+		return errAbort
+	}
+	if err := validateRequirements(all, archived...); err != nil {
+		printWarning("requires: is invalid:", err)
+	}
+	asJSON := c.Bool("json")
+	if !asJSON {
+		log.Println(statusSeparator)
+		// archived migrations that are applied, or squashed into a baseline, are not listed but counted
+		if n := len(archived) - countArchived(all); n > 0 {
+			log.Printf("%s %d migrations in %s/\n", archivedStatus, n, defaultArchiveFolder)
+		}
+	}
+	filter := newTagFilter(c)
+	entries := []statusEntry{}
 	for i, each := range all {
 		var status string
 		// check skipped
-		pass, err := evaluateCondition(each.IfExpression, envs)
-		isPending := each.Filename > mtx.lastApplied
+		isPending := sortsBefore(mtx.lastApplied, each.Filename)
+		if !filter.accepts(each) {
+			if isPending {
+				status = skipping
+			} else {
+				status = skipped
+			}
+			if asJSON {
+				entries = append(entries, newStatusEntry(each, status))
+				continue
+			}
+			if i > 0 && isPending {
+				log.Println(statusSeparator)
+			}
+			log.Printf("%s %s (filtered by tags)\n", status, pretty(each.Filename))
+			continue
+		}
+		condition := mtx.condition(each)
+		if !isPending {
+			// an if_command tells about the current infrastructure, not about when it was applied
+			condition.Probe = nil
+		}
+		pass, err := condition.evaluate(mtx.migrationEnv(each, "do"))
 		if err != nil {
 			if isPending {
 				status = conditionError
@@ -247,15 +459,47 @@ func cmdMigrationsStatus(c *cli.Context) error {
 		if err != nil {
 			printWarning("if: expression is invalid:", err)
 		}
+		if asJSON {
+			entries = append(entries, newStatusEntry(each, status))
+			continue
+		}
 		if i > 0 && isPending {
 			log.Println(statusSeparator)
 		}
-		log.Printf("%s %s\n", status, pretty(each.Filename))
+		log.Printf("%s %s%s%s\n", status, pretty(each.Filename), each.titleInfo(), each.variantInfo())
+	}
+	if asJSON {
+		data, _ := json.MarshalIndent(entries, "", "\t")
+		fmt.Println(string(data))
+		return nil
 	}
 	log.Println(statusSeparator)
 	return nil
 }
 
+// statusEntry is the JSON representation of the status of a migration.
+type statusEntry struct {
+	Filename    string   `json:"filename"`
+	Status      string   `json:"status"`
+	Description string   `json:"description,omitempty"`
+	Owner       string   `json:"owner,omitempty"`
+	Ticket      string   `json:"ticket,omitempty"`
+	Tags        []string `json:"tags,omitempty"`
+	Variant     string   `json:"variant,omitempty"`
+}
+
+func newStatusEntry(m Migration, status string) statusEntry {
+	return statusEntry{
+		Filename:    m.Filename,
+		Status:      strings.Trim(status, ".- "),
+		Description: m.Description,
+		Owner:       m.Owner,
+		Ticket:      m.Ticket,
+		Tags:        m.Tags,
+		Variant:     m.variant,
+	}
+}
+
 func cmdView(c *cli.Context) error {
 	mtx, err := getMigrationContext(c)
 	if err != nil {
@@ -266,7 +510,12 @@ func cmdView(c *cli.Context) error {
 	if len(c.Args()) == 2 {
 		localMigrationFilename := filepath.Base(c.Args().Get(1))
 		if len(localMigrationFilename) > 0 {
-			one, err := LoadMigration(filepath.Join(mtx.migrationsPath, localMigrationFilename))
+			filename, err := mtx.migrationFile(localMigrationFilename)
+			if err != nil {
+				printError(err.Error())
+				return errAbort
+			}
+			one, err := mtx.loadMigration(filename)
 			if err != nil {
 				printError(err.Error())
 				return errAbort
@@ -274,17 +523,32 @@ func cmdView(c *cli.Context) error {
 			all = append(all, one)
 		}
 	} else {
-		all, err = LoadMigrationsBetweenAnd(mtx.migrationsPath, "", "")
+		all, err = mtx.loadMigrationsBetweenAnd("", "")
 		if err != nil {
 			printError(err.Error())
 			return errAbort
 		}
 	}
+	filter := newTagFilter(c)
 	for _, each := range all {
+		if !filter.accepts(each) {
+			status := skipped
+			if sortsBefore(mtx.lastApplied, each.Filename) {
+				status = skipping
+			}
+			log.Printf("%s %s (filtered by tags)\n", status, pretty(each.Filename))
+			continue
+		}
 		log.Println(viewSeparatorTop)
 		log.Printf(" %s (%s)\n", pretty(each.Filename), each.Filename)
 		log.Println(viewSeparatorBottom)
-		if each.Filename > mtx.lastApplied {
+		if len(each.Description) > 0 {
+			for _, line := range strings.Split(each.Description, "\n") {
+				log.Println("", line)
+			}
+			log.Println(viewSeparatorBottom)
+		}
+		if sortsBefore(mtx.lastApplied, each.Filename) {
 			log.Println(" ** this migration is pending...")
 			break
 		}
@@ -294,7 +558,9 @@ func cmdView(c *cli.Context) error {
 		if mtx.config().verbose {
 			log.Printf("executing view section (%d commands)\n", len(each.ViewSection))
 		}
-		if err := ExecuteAll(each.IfExpression, each.ViewSection, mtx.shellEnv(), c.GlobalBool("v")); err != nil {
+		if err := forEachRun(each, "view", mtx.migrationEnv(each, "view"), func(runEnvs []string) error {
+			return ExecuteAll(mtx.condition(each), each.ViewSection, runEnvs, c.GlobalBool("v"))
+		}); err != nil {
 			printError(err.Error())
 			return errAbort
 		}
@@ -335,6 +601,26 @@ func cmdExportEnv(c *cli.Context) error {
 		printError(err.Error())
 		return errAbort
 	}
+	// outputs captured from applied migrations, loaded before printing anything
+	outputs := []string{}
+	if c.Bool("outputs") {
+		stateProvider, err := getStateProvider(c)
+		if err != nil {
+			printError(err.Error())
+			return errAbort
+		}
+		stateData, err := stateProvider.LoadState()
+		if err != nil {
+			printError(err.Error())
+			return errAbort
+		}
+		state, err := parseState(stateData)
+		if err != nil {
+			printError(err.Error())
+			return errAbort
+		}
+		outputs = state.outputEnv()
+	}
 
 	tmpl := "export %s=%s\n"
 	fmt.Printf(tmpl, "PROJECT", config.Project)
@@ -343,5 +629,9 @@ func cmdExportEnv(c *cli.Context) error {
 	for key, value := range config.EnvironmentVars {
 		fmt.Printf(tmpl, key, value)
 	}
+	for _, each := range outputs {
+		kv := strings.SplitN(each, "=", 2)
+		fmt.Printf(tmpl, kv[0], kv[1])
+	}
 	return nil
 }
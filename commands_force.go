@@ -2,7 +2,6 @@ package main
 
 import (
 	"fmt"
-	"path/filepath"
 
 	"github.com/urfave/cli"
 )
@@ -19,11 +18,13 @@ func cmdMigrationsSetState(c *cli.Context) error {
 			return errAbort
 		}
 	}
-	if err := checkExists(filepath.Join(mtx.migrationsPath, filename)); err != nil {
+	filename, err = mtx.migrationFile(filename)
+	if err != nil {
 		printError(err.Error())
 		return errAbort
 	}
-	if err := mtx.stateProvider.SaveState(filename); err != nil {
+	mtx.lastApplied = filename
+	if err := mtx.saveState(); err != nil {
 		printError(err.Error())
 		return errAbort
 	}
@@ -54,23 +55,60 @@ func runSectionOnly(c *cli.Context, isDo bool) error {
 			return errAbort
 		}
 	}
-	full := filepath.Join(mtx.migrationsPath, filename)
-	if err := checkExists(full); err != nil {
+	filename, err = mtx.migrationFile(filename)
+	if err != nil {
+		printError(err.Error())
+		return errAbort
+	}
+	m, err := mtx.loadMigration(filename)
+	if err != nil {
 		printError(err.Error())
 		return errAbort
 	}
-	m, err := LoadMigration(full)
+	all, err := mtx.loadMigrationsBetweenAnd("", "")
 	if err != nil {
 		printError(err.Error())
 		return errAbort
 	}
-	lines := m.DoSection
+	if isDo {
+		err = mtx.checkRequirementsApplied(m, all)
+	} else {
+		err = mtx.checkNotRequired(m, all)
+	}
+	if err != nil {
+		printError(err.Error())
+		return errAbort
+	}
+	envs := mtx.migrationEnv(m, section)
+	condition := mtx.condition(m)
 	if !isDo {
-		lines = m.UndoSection
+		condition = mtx.undoCondition(m)
+	}
+	if err := checkPreconditions(m, condition, envs, c.GlobalBool("v")); err != nil {
+		reportBlocked(m, err)
+		return errAbort
+	}
+	if isDo {
+		outputs, err := executeDo(m, condition, envs, c.GlobalBool("v"))
+		if err != nil {
+			reportError(mtx.stateProvider.Config(), envs, section, err)
+			return errAbort
+		}
+		if len(outputs) > 0 {
+			printWarning("outputs are not stored because the last applied migration is not updated:", outputs)
+		}
+	} else {
+		if err := forEachRun(m, section, envs, func(runEnvs []string) error {
+			return ExecuteAll(condition, m.UndoSection, runEnvs, c.GlobalBool("v"))
+		}); err != nil {
+			reportError(mtx.stateProvider.Config(), envs, section, err)
+			return errAbort
+		}
 	}
-	envs := mtx.shellEnv()
-	if err := ExecuteAll(m.IfExpression, lines, envs, c.GlobalBool("v")); err != nil {
-		reportError(mtx.stateProvider.Config(), envs, section, err)
+	// only the history is updated
+	mtx.history = mtx.appendHistory(newHistoryEntry(m, section))
+	if err := mtx.saveState(); err != nil {
+		reportError(mtx.stateProvider.Config(), envs, "save state", err)
 		return errAbort
 	}
 	return nil
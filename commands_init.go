@@ -33,6 +33,12 @@ project: my-project
 # Not required by gmig but some gcloud and gsutil commands do require it.
 # zone: europe-west1-b
 
+# [extends] is the filename, or folder, of a configuration relative to this one that provides the values that are absent here.
+# The env values of both are merged. Use gmig config show to see the effective configuration.
+#
+# Not required by gmig.
+# extends: ../base/gmig.yaml
+
 # [bucket] must be a valid GPC bucket.
 # A Google Storage Bucket is used to store information (object) about the last applied migration.
 # Bucket can contain multiple objects from multiple applications. Make sure the [state] is different for each app.
@@ -45,14 +51,75 @@ bucket: my-bucket
 # Required by gmig.
 state: myapp-gmig-last-migration
 
+# [target] is the name of this target, used to select the variant of a migration (see targets in a migration).
+# Its value is available as $GMIG_TARGET in your migrations.
+#
+# Not required by gmig. Defaults to the name of the folder of this file.
+# target: prod
+
+# [labels] are used to select the variant of a migration if there is none for the target.
+#
+# Not required by gmig.
+# labels:
+# - large
+
+# [migrations] are folders, relative to the migrations path, that are searched for migrations including their subfolders.
+# Migrations are applied in the order of their filenames, regardless of their folder.
+#
+# Not required by gmig. Defaults to the migrations path only, without subfolders.
+# migrations:
+# - iam
+# - network
+
+# [renames] maps old filenames of migrations to new ones, if applied migrations have been renamed.
+# This overrides the renames.yaml file in the migrations path, if present.
+#
+# Not required by gmig.
+# renames:
+#   010_create_ip.yaml: 010_create_static_ip.yaml
+
+# [undo_rules] are commands that create a resource and the command that deletes it, used by lint to check undo sections.
+# These are added to the known gcloud and gsutil commands.
+#
+# Not required by gmig.
+# undo_rules:
+# - create: gcloud artifacts repositories create
+#   delete: gcloud artifacts repositories delete
+
+# [naming] sets how gmig new makes the filename of a new migration.
+# strategy is one of index (e.g. 045_), timestamp (e.g. 20060102t150405_) or hybrid (e.g. 045_20060102t150405_).
+# step is added to the index of the last migration.
+#
+# Not required by gmig. Defaults to index with step 5.
+# naming:
+#   strategy: index
+#   step: 5
+
+# [templates] is the folder, relative to the migrations path, with templates for new migrations (gmig new --template).
+#
+# Not required by gmig. Defaults to templates.
+# templates: templates
+
+# [history] is the number of runs of do and undo sections that are kept in the state of the target (gmig history).
+#
+# Not required by gmig. Defaults to 0, no history is kept.
+# history: 100
+
+# [if_typed_env] if true then if expressions see the values of env as typed, such as numbers, booleans and lists, instead of as strings.
+#
+# Not required by gmig. Defaults to false.
+# if_typed_env: true
+
 # [env] are additional environment values that are available to each section of a migration file.
 # This can be used to create migrations that are independent of the target project.
 # By convention, use capitalized words for keys.
 # In the example, "myapp-cluster" is available as $K8S_CLUSTER in your migrations.
+# Values can refer to PROJECT, REGION, ZONE and other keys using ${KEY}, e.g. "my-project-gke" for $GKE_CLUSTER.
 #
 # Not required by gmig.
 #env:
 #  K8S_CLUSTER: myapp-cluster
+#  GKE_CLUSTER: ${PROJECT}-gke
 `
 
 func cmdInit(c *cli.Context) error {
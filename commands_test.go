@@ -1,9 +1,14 @@
 package main
 
 import (
+	"bytes"
 	"errors"
+	"io"
+	"log"
 	"os"
+	"os/exec"
 	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -322,3 +327,160 @@ func TestCmdUpConditionalFail(t *testing.T) {
 		t.Errorf("got [%v] want [%v]", got, want)
 	}
 }
+
+func TestCmdViewWithTags(t *testing.T) {
+	osTempDir = func() string { return "." }
+	dir := t.TempDir()
+	for filename, content := range map[string]string{
+		"010_iam.yaml":     "tags: [iam]\ndo:\n- echo do\nview:\n- echo view iam",
+		"020_network.yaml": "tags: [iam, network]\ndo:\n- echo do\nview:\n- echo view network",
+		"030_other.yaml":   "do:\n- echo do\nview:\n- echo view other",
+		"040_pending.yaml": "tags: [iam]\ndo:\n- echo do\nview:\n- echo view pending",
+	} {
+		writeConfigFile(t, filepath.Join(dir, filename), content)
+	}
+	// simulate effect of GS download state
+	if err := os.WriteFile("state", []byte("030_other.yaml"), os.ModePerm); err != nil {
+		t.Fatal("unable to write state", err)
+	}
+	defer os.Remove("state")
+	out := new(bytes.Buffer)
+	log.SetOutput(out)
+	defer log.SetOutput(os.Stderr)
+	cc := new(commandCapturer)
+	views := []string{}
+	runCommand = func(cmd *exec.Cmd) ([]byte, error) {
+		if cmd.Args[0] == "sh" {
+			script, _ := os.ReadFile(cmd.Args[2])
+			lines := strings.Split(strings.TrimSpace(string(script)), "\n")
+			views = append(views, lines[len(lines)-1])
+		}
+		return cc.runCommand(cmd)
+	}
+	if err := newApp().Run([]string{"gmig", "view", "test/demo", "--migrations", dir, "--tags", "iam", "--exclude-tags", "network"}); err != nil {
+		t.Fatal("unexpected error", err)
+	}
+	if got, want := strings.Join(views, ","), "echo view iam"; got != want {
+		t.Errorf("got [%v] want [%v]", got, want)
+	}
+	sh := 0
+	for _, each := range cc.args {
+		if each[0] == "sh" {
+			sh++
+		}
+	}
+	if got, want := sh, 1; got != want {
+		t.Errorf("got [%v] want [%v]", got, want)
+	}
+	filtered := []string{}
+	for _, line := range strings.Split(out.String(), "\n") {
+		if strings.HasSuffix(line, "(filtered by tags)") {
+			filtered = append(filtered, line[strings.Index(line, skipped):])
+		}
+	}
+	if got, want := strings.Join(filtered, ","), skipped+" "+pretty("020_network.yaml")+" (filtered by tags),"+skipped+" "+pretty("030_other.yaml")+" (filtered by tags)"; got != want {
+		t.Errorf("got [%v] want [%v]", got, want)
+	}
+	if got, want := out.String(), "this migration is pending"; !strings.Contains(got, want) {
+		t.Errorf("got [%v] want [%v]", got, want)
+	}
+}
+
+func TestCmdDownAll(t *testing.T) {
+	keepState()
+	// simulate effect of GS download old state
+	if err := os.WriteFile("state", []byte("020_two.yaml"), os.ModePerm); err != nil {
+		t.Fatal("unable to write state", err)
+	}
+	defer os.Remove("state")
+	// capture GC command
+	cc := new(commandCapturer)
+	runCommand = cc.runCommand
+	if err := newApp().Run([]string{"gmig", "down-all", "test/demo"}); err != nil {
+		wd, _ := os.Getwd()
+		t.Fatal("unexpected error", err, wd)
+	}
+	data, err := os.ReadFile("state")
+	if err != nil {
+		t.Fatal("unreadable state", err)
+	}
+	if got, want := string(data), ""; got != want {
+		t.Errorf("got [%v] want [%v]", got, want)
+	}
+}
+
+func TestCmdUpRecordsHistory(t *testing.T) {
+	keepState()
+	if err := os.WriteFile("state", []byte(""), os.ModePerm); err != nil {
+		t.Fatal("unable to write state", err)
+	}
+	defer os.Remove("state")
+	cfg, err := TryToLoadConfig("test/demo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// keep only the last run
+	cfg.History = 1
+	defer func(old StateProvider) { currentStateProvider = old }(currentStateProvider)
+	currentStateProvider = NewGCS(*cfg)
+	cc := new(commandCapturer)
+	runCommand = cc.runCommand
+	if err := newApp().Run([]string{"gmig", "up", "test/demo", "020_two.yaml"}); err != nil {
+		t.Fatal("unexpected error", err)
+	}
+	data, err := os.ReadFile("state")
+	if err != nil {
+		t.Fatal("unreadable state", err)
+	}
+	state, err := parseState(string(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := len(state.History), 1; got != want {
+		t.Fatalf("got [%v] want [%v]", got, want)
+	}
+	if got, want := state.History[0].Filename+":"+state.History[0].Section+":"+state.History[0].Description, "020_two.yaml:do:two"; got != want {
+		t.Errorf("got [%v] want [%v]", got, want)
+	}
+	if err := newApp().Run([]string{"gmig", "history", "test/demo", "--json"}); err != nil {
+		t.Fatal("unexpected error", err)
+	}
+}
+
+func captureStdout(t *testing.T, run func()) string {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = w
+	defer func() { os.Stdout = stdout }()
+	run()
+	w.Close()
+	data, _ := io.ReadAll(r)
+	return string(data)
+}
+
+func TestCmdExportEnvOffline(t *testing.T) {
+	cc := &commandCapturer{err: errors.New("exit status 1"), output: []byte("AccessDeniedException: 403")}
+	runCommand = cc.runCommand
+	out := captureStdout(t, func() {
+		if err := newApp().Run([]string{"gmig", "export-env", "test/demo"}); err != nil {
+			t.Error("unexpected error", err)
+		}
+	})
+	if got, want := len(cc.args), 0; got != want {
+		t.Errorf("got [%v] want [%v]", got, want)
+	}
+	if got, want := out, "export PROJECT=demo\n"; !strings.Contains(got, want) {
+		t.Errorf("got [%v] want [%v]", got, want)
+	}
+	out = captureStdout(t, func() {
+		if err := newApp().Run([]string{"gmig", "export-env", "test/demo", "--outputs"}); err == nil {
+			t.Error("expected error")
+		}
+	})
+	if got, want := out, ""; got != want {
+		t.Errorf("got [%v] want [%v]", got, want)
+	}
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/expr-lang/expr"
+	"github.com/expr-lang/expr/vm"
+)
+
+// Condition is an if expression together with the values it can use besides those of the environment.
+type Condition struct {
+	Expression string
+	// Values are typed values that override the string values of the environment.
+	Values map[string]interface{}
+	// MigrationsPath is the folder to which fileExists is relative.
+	MigrationsPath string
+	// OSEnv if true then getenv can read values from the OS environment.
+	OSEnv bool
+	// Probe holds shell commands that must exit with code 0 for the condition to be true.
+	Probe []string
+	// Name identifies the probe in the cache.
+	Name string
+	// probes caches the results of probes ; can be nil.
+	probes map[string]bool
+	// recorded if true then the probe is not run ; only its results in probes apply.
+	recorded bool
+	// verbose if true then show the output of the probe
+	verbose bool
+}
+
+// String returns a description for logging.
+func (c Condition) String() string {
+	if len(c.Probe) == 0 {
+		return c.Expression
+	}
+	if len(c.Expression) == 0 {
+		return "if_command"
+	}
+	return c.Expression + " and if_command"
+}
+
+// evaluate evaluates the expression and then the probe to a bool ; report error otherwise.
+func (c Condition) evaluate(envs []string) (bool, error) {
+	pass, err := c.evaluateExpression(envs)
+	if err != nil || !pass {
+		return pass, err
+	}
+	return c.evaluateProbe(envs)
+}
+
+func (c Condition) evaluateExpression(envs []string) (bool, error) {
+	if len(c.Expression) == 0 {
+		return true, nil
+	}
+	env := c.expressionEnv(envs)
+	program, err := c.compile(env)
+	if err != nil {
+		return false, err
+	}
+	output, err := expr.Run(program, env)
+	if err != nil {
+		return false, err
+	}
+	if b, ok := output.(bool); ok {
+		return b, nil
+	}
+	return false, errors.New("expression does not evaluate to a boolean")
+}
+
+// compile checks the expression against the names and types of the values and functions available to it.
+func (c Condition) compile(env map[string]interface{}) (*vm.Program, error) {
+	return expr.Compile(c.Expression, expr.Env(env), expr.AsBool())
+}
+
+// evaluateProbe runs the probe commands, if any, and returns true if they exit with code 0.
+// Results are cached per migration and foreach item.
+func (c Condition) evaluateProbe(envs []string) (bool, error) {
+	if len(c.Probe) == 0 {
+		return true, nil
+	}
+	item, _ := lookupEnv(envs, "ITEM")
+	key := c.Name + "|" + item
+	if pass, ok := c.probes[key]; ok {
+		return pass, nil
+	}
+	if c.recorded {
+		return true, nil
+	}
+	tempScript, err := writeScript(c.Probe, c.verbose)
+	if err != nil {
+		return false, err
+	}
+	defer removeScript(tempScript)
+	cmd := exec.Command("sh", "-c", tempScript)
+	cmd.Env = append(os.Environ(), envs...) // extend, not replace
+	out, err := runCommand(cmd)
+	if c.verbose {
+		log.Printf("if_command of %s exited with error:%v\n%s\n", c.Name, err, string(out))
+	}
+	pass := err == nil
+	if c.probes != nil {
+		c.probes[key] = pass
+	}
+	return pass, nil
+}
+
+// expressionEnv returns all values and functions available to the expression.
+func (c Condition) expressionEnv(envs []string) map[string]interface{} {
+	env := map[string]interface{}{}
+	for _, each := range envs {
+		kv := strings.SplitN(each, "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		env[strings.TrimSpace(kv[0])] = strings.TrimSpace(kv[1])
+	}
+	for k, v := range c.Values {
+		env[k] = v
+	}
+	env["fileExists"] = func(name string) bool {
+		_, err := os.Stat(filepath.Join(c.MigrationsPath, name))
+		return err == nil
+	}
+	env["semver"] = compareSemver
+	env["getenv"] = func(name string) (string, error) {
+		if !c.OSEnv {
+			return "", errors.New("access to the OS environment is not enabled (if_os_env in configuration)")
+		}
+		return os.Getenv(name), nil
+	}
+	return env
+}
+
+// compareSemver returns -1, 0 or 1 when version a is lower, equal or higher than version b.
+// A leading "v" and any pre-release or build suffix (after "-" or "+") are ignored.
+func compareSemver(a, b string) (int, error) {
+	pa, err := semverParts(a)
+	if err != nil {
+		return 0, err
+	}
+	pb, err := semverParts(b)
+	if err != nil {
+		return 0, err
+	}
+	for i := 0; i < len(pa) || i < len(pb); i++ {
+		var x, y int
+		if i < len(pa) {
+			x = pa[i]
+		}
+		if i < len(pb) {
+			y = pb[i]
+		}
+		if x < y {
+			return -1, nil
+		}
+		if x > y {
+			return 1, nil
+		}
+	}
+	return 0, nil
+}
+
+func semverParts(version string) (parts []int, err error) {
+	v := strings.TrimPrefix(strings.TrimSpace(version), "v")
+	if i := strings.IndexAny(v, "-+"); i != -1 {
+		v = v[:i]
+	}
+	for _, each := range strings.Split(v, ".") {
+		n, err := strconv.Atoi(each)
+		if err != nil {
+			return nil, fmt.Errorf("invalid semantic version [%s]", version)
+		}
+		parts = append(parts, n)
+	}
+	return
+}
+
+// skippedProbes returns the sorted keys of the probes of a migration that were false.
+func skippedProbes(probes map[string]bool, filename string) (keys []string) {
+	for key, pass := range probes {
+		if !pass && strings.HasPrefix(key, filename+"|") {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return
+}
+
+// withoutSkippedOf returns the skipped probes except those of a migration.
+func withoutSkippedOf(skipped []string, filename string) (kept []string) {
+	for _, each := range skipped {
+		if !sameMigration(strings.SplitN(each, "|", 2)[0], filename) {
+			kept = append(kept, each)
+		}
+	}
+	return
+}
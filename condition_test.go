@@ -0,0 +1,195 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestConditionValueWithEquals(t *testing.T) {
+	ok, err := evaluateCondition(`FILTER == "name=web"`, []string{"FILTER=name=web"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := ok, true; got != want {
+		t.Errorf("got [%v] want [%v]", got, want)
+	}
+}
+
+func TestConditionTypedValuesAndFunctions(t *testing.T) {
+	c := Condition{
+		Values: map[string]interface{}{
+			"REPLICAS": 3,
+			"ENABLED":  true,
+			"REGIONS":  []interface{}{"europe-west1", "us-central1"},
+			"TARGET":   "prod",
+		},
+		MigrationsPath: "test",
+	}
+	for _, each := range []string{
+		`REPLICAS > 2 && ENABLED`,
+		`"us-central1" in REGIONS`,
+		`PROJECT matches "^prod-"`,
+		`semver(GKE_VERSION, "1.27.0") >= 0`,
+		`semver("v1.9", "1.10") < 0`,
+		`fileExists("010_one.yaml") && !fileExists("999_missing.yaml")`,
+		`TARGET == "prod"`,
+	} {
+		c.Expression = each
+		ok, err := c.evaluate([]string{"PROJECT=prod-123", "GKE_VERSION=1.27.3-gke.100"})
+		if err != nil {
+			t.Fatal(each, err)
+		}
+		if !ok {
+			t.Errorf("expected [%s] to be true", each)
+		}
+	}
+}
+
+func TestConditionOSEnv(t *testing.T) {
+	os.Setenv("GMIG_TEST_OS_ENV", "yes")
+	defer os.Unsetenv("GMIG_TEST_OS_ENV")
+	c := Condition{Expression: `getenv("GMIG_TEST_OS_ENV") == "yes"`}
+	if _, err := c.evaluate([]string{}); err == nil {
+		t.Error("expected error when OS environment is not enabled")
+	}
+	c.OSEnv = true
+	ok, err := c.evaluate([]string{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := ok, true; got != want {
+		t.Errorf("got [%v] want [%v]", got, want)
+	}
+}
+
+func TestConfigTypedEnv(t *testing.T) {
+	dir := t.TempDir()
+	yaml := "project: demo\nbucket: bucket\nstate: state\nenv:\n  REPLICAS: 3\n  REGIONS:\n  - europe-west1\n  - us-central1\n"
+	if err := os.WriteFile(filepath.Join(dir, YAMLConfigFilename), []byte(yaml), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	c, err := TryToLoadConfig(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := c.EnvironmentVars["REGIONS"], "europe-west1,us-central1"; got != want {
+		t.Errorf("got [%v] want [%v]", got, want)
+	}
+	if got, want := c.typedEnv["REPLICAS"], 3; got != want {
+		t.Errorf("got [%v] want [%v]", got, want)
+	}
+}
+
+func TestConditionProbeIsCached(t *testing.T) {
+	cc := new(commandCapturer)
+	cc.err = errors.New("exit status 1")
+	runCommand = cc.runCommand
+	c := Condition{Probe: []string{"gcloud services list | grep -q sqladmin"}, Name: "010_one.yaml", probes: map[string]bool{}}
+	for i := 0; i < 2; i++ {
+		ok, err := c.evaluate([]string{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, want := ok, false; got != want {
+			t.Errorf("got [%v] want [%v]", got, want)
+		}
+	}
+	if got, want := len(cc.args), 1; got != want {
+		t.Errorf("got [%v] want [%v]", got, want)
+	}
+}
+
+func TestConditionProbeNotRunWhenExpressionIsFalse(t *testing.T) {
+	cc := new(commandCapturer)
+	runCommand = cc.runCommand
+	c := Condition{Expression: `ENV == "B"`, Probe: []string{"true"}}
+	ok, err := c.evaluate([]string{"ENV=A"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := ok, false; got != want {
+		t.Errorf("got [%v] want [%v]", got, want)
+	}
+	if got, want := len(cc.args), 0; got != want {
+		t.Errorf("got [%v] want [%v]", got, want)
+	}
+}
+
+func TestUndoConditionWithoutProbe(t *testing.T) {
+	defer func(old func(*exec.Cmd) ([]byte, error)) { runCommand = old }(runCommand)
+	cc := new(commandCapturer)
+	runCommand = cc.runCommand
+	mtx := migrationContext{stateProvider: NewFileStateProvider(Config{Project: "demo"})}
+	m := Migration{Filename: "010_one.yaml", IfExpression: `PROJECT == "demo"`, IfCommand: []string{"exit 1"}}
+	pass, err := mtx.undoCondition(m).evaluate(mtx.migrationEnv(m, "undo"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !pass {
+		t.Error("undo condition must pass without the probe")
+	}
+	if got, want := len(cc.args), 0; got != want {
+		t.Errorf("got [%v] want [%v]", got, want)
+	}
+}
+
+func TestUndoConditionSkippedByProbe(t *testing.T) {
+	defer func(old func(*exec.Cmd) ([]byte, error)) { runCommand = old }(runCommand)
+	cc := &commandCapturer{err: errors.New("exit status 1")}
+	runCommand = cc.runCommand
+	mtx := migrationContext{stateProvider: NewFileStateProvider(Config{Project: "demo"}), probes: map[string]bool{}}
+	m := Migration{Filename: "010_one.yaml", IfCommand: []string{"exit 1"}}
+	pass, err := mtx.condition(m).evaluate(mtx.migrationEnv(m, "do"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pass {
+		t.Fatal("probe must skip do")
+	}
+	mtx.skipped = skippedProbes(mtx.probes, m.Filename)
+	if got, want := strings.Join(mtx.skipped, ","), "010_one.yaml|"; got != want {
+		t.Errorf("got [%v] want [%v]", got, want)
+	}
+	back, _ := parseState(State{LastApplied: m.Filename, Skipped: mtx.skipped}.String())
+	mtx = migrationContext{stateProvider: mtx.stateProvider, skipped: back.Skipped}
+	pass, err = mtx.undoCondition(m).evaluate(mtx.migrationEnv(m, "undo"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pass {
+		t.Error("undo must be skipped")
+	}
+	if got, want := len(cc.args), 1; got != want {
+		t.Errorf("got [%v] want [%v]", got, want)
+	}
+	if got := withoutSkippedOf(back.Skipped, m.Filename); len(got) != 0 {
+		t.Errorf("got [%v] want none", got)
+	}
+}
+
+func TestConditionTypedEnvIsOptIn(t *testing.T) {
+	cfg := Config{Project: "demo", EnvironmentVars: EnvironmentValues{"REPLICAS": "3"}, typedEnv: map[string]interface{}{"REPLICAS": 3}}
+	m := Migration{Filename: "010_one.yaml", IfExpression: `REPLICAS == "3"`}
+	mtx := migrationContext{stateProvider: NewFileStateProvider(cfg)}
+	pass, err := mtx.condition(m).evaluate(mtx.migrationEnv(m, "do"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !pass {
+		t.Error("string comparison must pass")
+	}
+	cfg.IfTypedEnv = true
+	m.IfExpression = "REPLICAS > 2"
+	mtx = migrationContext{stateProvider: NewFileStateProvider(cfg)}
+	pass, err = mtx.condition(m).evaluate(mtx.migrationEnv(m, "do"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !pass {
+		t.Error("typed comparison must pass")
+	}
+}
@@ -1,11 +1,12 @@
 package main
 
 import (
+	"bytes"
 	"encoding/json"
 	"errors"
 	"fmt"
-	"os"
 	"path/filepath"
+	"strings"
 
 	"gopkg.in/yaml.v2"
 )
@@ -17,6 +18,10 @@ const ymlConfigFilename = "gmig.yml"
 
 // Config holds gmig program config
 type Config struct {
+	// Extends is the filename, relative to this configuration, of a configuration that provides the values that are absent in this one.
+	// The env values of both are merged. Optional.
+	Extends string `json:"extends,omitempty" yaml:"extends,omitempty"`
+
 	// Project is a GCP project name.
 	Project string `json:"project" yaml:"project"`
 
@@ -26,6 +31,13 @@ type Config struct {
 	// Region is a GCP zone. Optional, use the default one if absent.
 	Zone string `json:"zone,omitempty" yaml:"zone,omitempty"`
 
+	// Target is the name of this configuration, used to select variants of migrations.
+	// Optional, use the name of the folder of the configuration if absent.
+	Target string `json:"target,omitempty" yaml:"target,omitempty"`
+
+	// Labels are used to select variants of migrations if there is none for the Target.
+	Labels []string `json:"labels,omitempty" yaml:"labels,omitempty"`
+
 	// Bucket is the name of the Google Storage Bucket.
 	Bucket string `json:"bucket" yaml:"bucket"`
 
@@ -35,28 +47,62 @@ type Config struct {
 	// EnvironmentVars hold additional environment values
 	// that can be accessed by each command line in the Do & Undo section.
 	// Note that PROJECT,REGION and ZONE are already available.
-	EnvironmentVars map[string]string `json:"env,omitempty" yaml:"env,omitempty"`
+	// Values that are lists are available as comma separated strings.
+	// Values can refer to PROJECT,REGION,ZONE and other keys using ${KEY}.
+	EnvironmentVars EnvironmentValues `json:"env,omitempty" yaml:"env,omitempty"`
+
+	// Migrations are the folders, relative to the migrations path, that are searched for migrations including their subfolders.
+	// Optional, only the migrations path itself is searched if absent.
+	Migrations []string `json:"migrations,omitempty" yaml:"migrations,omitempty"`
+
+	// Renames maps old filenames of migrations to new ones, such that the state can refer to an old filename.
+	// These are merged over those of the renames.yaml in the migrations path.
+	Renames map[string]string `json:"renames,omitempty" yaml:"renames,omitempty"`
+
+	// UndoRules are added to the known commands that create a resource and their inverse, used by lint.
+	UndoRules []UndoRule `json:"undo_rules,omitempty" yaml:"undo_rules,omitempty"`
+
+	// Naming holds how filenames of new migrations are made.
+	Naming Naming `json:"naming,omitempty" yaml:"naming,omitempty"`
+
+	// Templates is the folder, relative to the migrations path, with templates for new migrations.
+	// Optional, use the folder "templates" if absent.
+	Templates string `json:"templates,omitempty" yaml:"templates,omitempty"`
+
+	// Template if true then the sections of all migrations are rendered as Go templates.
+	Template bool `json:"template,omitempty" yaml:"template,omitempty"`
+
+	// IfOSEnv if true then if expressions can read the OS environment using getenv.
+	IfOSEnv bool `json:"if_os_env,omitempty" yaml:"if_os_env,omitempty"`
+
+	// History is the number of runs of do and undo sections that are kept in the state of the target, latest last.
+	// Optional, no history is kept if absent.
+	History int `json:"history,omitempty" yaml:"history,omitempty"`
+
+	// IfTypedEnv if true then if expressions see the values of env as typed in the source instead of as strings.
+	IfTypedEnv bool `json:"if_typed_env,omitempty" yaml:"if_typed_env,omitempty"`
+
+	// typedEnv holds the values of env as typed in the source (numbers,booleans,lists).
+	typedEnv map[string]interface{}
 
 	// verbose if true then produce more logging.
 	verbose bool
 
 	// source filename
 	filename string
+
+	// origins maps each key, and env.KEY for env values, to the source filename that has set it.
+	origins map[string]string
 }
 
 func loadAndUnmarshalConfig(location string, unmarshaller func(in []byte, out interface{}) (err error)) (*Config, error) {
-	data, err := os.ReadFile(location)
-
+	c, err := loadConfigExtending(location, unmarshaller, []string{})
 	if err != nil {
 		return nil, err
 	}
 
-	c := &Config{
-		filename: location,
-	}
-
-	if err := unmarshaller(data, &c); err != nil {
-		return nil, err
+	if err := c.interpolate(); err != nil {
+		return nil, fmt.Errorf("%s: %v", location, err)
 	}
 
 	if err := c.Validate(); err != nil {
@@ -128,3 +174,79 @@ func (c Config) shellEnv() (envs []string) {
 	}
 	return
 }
+
+// EnvironmentValues holds custom environment values, as written in the source.
+// Lists of values are stored comma separated.
+type EnvironmentValues map[string]string
+
+// UnmarshalYAML implements yaml.Unmarshaler
+func (e *EnvironmentValues) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var values map[string]envValue
+	if err := unmarshal(&values); err != nil {
+		return err
+	}
+	if values == nil {
+		*e = nil
+		return nil
+	}
+	env := EnvironmentValues{}
+	for k, v := range values {
+		env[k] = string(v)
+	}
+	*e = env
+	return nil
+}
+
+// envValue is the text of a YAML env value, such that 1.20 is not changed into 1.2 ; items of a list are comma separated.
+type envValue string
+
+// UnmarshalYAML implements yaml.Unmarshaler
+func (v *envValue) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var text string
+	if err := unmarshal(&text); err == nil {
+		*v = envValue(text)
+		return nil
+	}
+	var items []string
+	if err := unmarshal(&items); err != nil {
+		return err
+	}
+	*v = envValue(strings.Join(items, ","))
+	return nil
+}
+
+// UnmarshalJSON implements json.Unmarshaler
+func (e *EnvironmentValues) UnmarshalJSON(data []byte) error {
+	var values map[string]interface{}
+	// keep numbers as written, such that 1000000 is not changed into 1e+06
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(&values); err != nil {
+		return err
+	}
+	*e = environmentValuesFrom(values)
+	return nil
+}
+
+func environmentValuesFrom(values map[string]interface{}) EnvironmentValues {
+	if values == nil {
+		return nil
+	}
+	env := EnvironmentValues{}
+	for k, v := range values {
+		if list, ok := v.([]interface{}); ok {
+			items := []string{}
+			for _, each := range list {
+				items = append(items, fmt.Sprint(each))
+			}
+			env[k] = strings.Join(items, ",")
+			continue
+		}
+		if v == nil {
+			env[k] = ""
+			continue
+		}
+		env[k] = fmt.Sprint(v)
+	}
+	return env
+}
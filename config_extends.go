@@ -0,0 +1,181 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/urfave/cli"
+	"gopkg.in/yaml.v2"
+)
+
+// unmarshallerFor returns the JSON or YAML unmarshaller for a configuration file by its extension.
+func unmarshallerFor(location string) func(in []byte, out interface{}) error {
+	if filepath.Ext(location) == ".json" {
+		return json.Unmarshal
+	}
+	return yaml.Unmarshal
+}
+
+// loadConfigExtending reads a configuration, without validating it, merged over the one it extends, if any.
+// The chain has the absolute filenames of the configurations that extend this one, to detect cycles.
+func loadConfigExtending(location string, unmarshaller func(in []byte, out interface{}) error, chain []string) (*Config, error) {
+	abs, err := filepath.Abs(location)
+	if err != nil {
+		return nil, err
+	}
+	for _, each := range chain {
+		if each == abs {
+			return nil, fmt.Errorf("cyclic extends of configuration [%s]", strings.Join(append(chain, abs), " -> "))
+		}
+	}
+	data, err := os.ReadFile(location)
+	if err != nil {
+		return nil, err
+	}
+	c := &Config{filename: location}
+	if err := unmarshaller(data, &c); err != nil {
+		return nil, fmt.Errorf("%s parsing failed: %v", location, err)
+	}
+	typed := struct {
+		Env map[string]interface{} `json:"env" yaml:"env"`
+	}{}
+	if err := unmarshaller(data, &typed); err != nil {
+		return nil, err
+	}
+	c.typedEnv = typed.Env
+	keys := map[string]interface{}{}
+	if err := unmarshaller(data, &keys); err != nil {
+		return nil, err
+	}
+	if len(c.Extends) == 0 {
+		c.origins = map[string]string{}
+		for k := range keys {
+			c.origins[k] = location
+		}
+		for k := range c.EnvironmentVars {
+			c.origins["env."+k] = location
+		}
+		return c, nil
+	}
+	parentLocation, err := extendedConfigFile(filepath.Join(filepath.Dir(location), c.Extends))
+	if err != nil {
+		return nil, fmt.Errorf("%s extends: %v", location, err)
+	}
+	parent, err := loadConfigExtending(parentLocation, unmarshallerFor(parentLocation), append(chain, abs))
+	if err != nil {
+		return nil, err
+	}
+	parent.overlay(c, keys)
+	parent.filename = location
+	return parent, nil
+}
+
+// extendedConfigFile returns the configuration file at the location, which can also be a folder with a configuration.
+func extendedConfigFile(location string) (string, error) {
+	info, err := os.Stat(location)
+	if err != nil {
+		return "", err
+	}
+	if !info.IsDir() {
+		return location, nil
+	}
+	for _, each := range []string{YAMLConfigFilename, ymlConfigFilename, jsonConfigFilename} {
+		if checkExists(filepath.Join(location, each)) == nil {
+			return filepath.Join(location, each), nil
+		}
+	}
+	return "", fmt.Errorf("can not find any configuration in [%s]", location)
+}
+
+// overlay sets the fields of the child configuration that are present, by their keys, in its source.
+// The env values are merged such that the child only needs the values that differ.
+func (c *Config) overlay(child *Config, keys map[string]interface{}) {
+	parent := reflect.ValueOf(c).Elem()
+	values := reflect.ValueOf(child).Elem()
+	for i := 0; i < parent.NumField(); i++ {
+		key := strings.Split(parent.Type().Field(i).Tag.Get("yaml"), ",")[0]
+		if _, ok := keys[key]; !ok || len(key) == 0 {
+			continue
+		}
+		c.origins[key] = child.filename
+		if key == "env" {
+			continue
+		}
+		parent.Field(i).Set(values.Field(i))
+	}
+	if len(child.EnvironmentVars) > 0 && c.EnvironmentVars == nil {
+		c.EnvironmentVars = EnvironmentValues{}
+	}
+	for k, v := range child.EnvironmentVars {
+		c.EnvironmentVars[k] = v
+		c.origins["env."+k] = child.filename
+	}
+	if len(child.typedEnv) > 0 && c.typedEnv == nil {
+		c.typedEnv = map[string]interface{}{}
+	}
+	for k, v := range child.typedEnv {
+		c.typedEnv[k] = v
+	}
+}
+
+// withOrigins returns the YAML representation with a comment on each line that tells which configuration file has set it.
+func (c Config) withOrigins() string {
+	out := new(strings.Builder)
+	section := ""
+	for _, line := range strings.Split(strings.TrimRight(c.ToYAML(), "\n"), "\n") {
+		origin := ""
+		if !strings.HasPrefix(line, " ") && !strings.HasPrefix(line, "-") {
+			section = strings.SplitN(line, ":", 2)[0]
+			if section != "env" {
+				// env values are merged, each has its own origin
+				origin = c.origins[section]
+			}
+		} else if section == "env" {
+			origin = c.origins["env."+strings.SplitN(strings.TrimSpace(line), ":", 2)[0]]
+		}
+		if len(origin) > 0 {
+			fmt.Fprintf(out, "%s # %s\n", line, origin)
+		} else {
+			fmt.Fprintln(out, line)
+		}
+	}
+	return out.String()
+}
+
+// configFiles returns the distinct files that have set a value of the configuration.
+func (c Config) configFiles() (files []string) {
+	seen := map[string]bool{}
+	for _, each := range c.origins {
+		if !seen[each] {
+			seen[each] = true
+			files = append(files, each)
+		}
+	}
+	sort.Strings(files)
+	return
+}
+
+func cmdConfigShow(c *cli.Context) error {
+	pathToConfig := c.Args().First()
+	if len(pathToConfig) == 0 {
+		printError("missing path containing gmig.yaml in command line")
+		return errAbort
+	}
+	cfg, err := TryToLoadConfig(pathToConfig)
+	if err != nil {
+		printError(err.Error())
+		return errAbort
+	}
+	if c.Bool("json") {
+		fmt.Println(cfg.ToJSON())
+		return nil
+	}
+	fmt.Printf("# effective configuration of [%s] from %s\n", cfg.filename, strings.Join(cfg.configFiles(), ","))
+	fmt.Print(cfg.withOrigins())
+	return nil
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeConfigFile(t *testing.T, filename, content string) {
+	if err := os.MkdirAll(filepath.Dir(filename), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filename, []byte(content), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestConfigExtends(t *testing.T) {
+	dir := t.TempDir()
+	writeConfigFile(t, filepath.Join(dir, "base", "gmig.json"), `{
+	"project": "base-project",
+	"region": "europe-west1",
+	"bucket": "base-bucket",
+	"state": "base-state",
+	"env": {"REPLICAS": 1, "CLUSTER": "base"}
+}`)
+	writeConfigFile(t, filepath.Join(dir, "prod", "gmig.yaml"), `
+extends: ../base
+project: prod-project
+env:
+  REPLICAS: 3
+  ZONES: [a, b]
+`)
+	cfg, err := TryToLoadConfig(filepath.Join(dir, "prod"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := cfg.Project, "prod-project"; got != want {
+		t.Errorf("got [%v] want [%v]", got, want)
+	}
+	if got, want := cfg.Bucket, "base-bucket"; got != want {
+		t.Errorf("got [%v] want [%v]", got, want)
+	}
+	if got, want := cfg.EnvironmentVars["REPLICAS"], "3"; got != want {
+		t.Errorf("got [%v] want [%v]", got, want)
+	}
+	if got, want := cfg.EnvironmentVars["CLUSTER"], "base"; got != want {
+		t.Errorf("got [%v] want [%v]", got, want)
+	}
+	if got, want := cfg.EnvironmentVars["ZONES"], "a,b"; got != want {
+		t.Errorf("got [%v] want [%v]", got, want)
+	}
+	if got, want := cfg.typedEnv["REPLICAS"], 3; got != want {
+		t.Errorf("got [%v] want [%v]", got, want)
+	}
+	if got, want := filepath.Base(filepath.Dir(cfg.origins["region"])), "base"; got != want {
+		t.Errorf("got [%v] want [%v]", got, want)
+	}
+	if got, want := filepath.Base(filepath.Dir(cfg.origins["env.REPLICAS"])), "prod"; got != want {
+		t.Errorf("got [%v] want [%v]", got, want)
+	}
+	if got, want := filepath.Base(filepath.Dir(cfg.filename)), "prod"; got != want {
+		t.Errorf("got [%v] want [%v]", got, want)
+	}
+	shown := cfg.withOrigins()
+	if !strings.Contains(shown, "project: prod-project # "+filepath.Join(dir, "prod", "gmig.yaml")) {
+		t.Errorf("missing origin of project in\n%s", shown)
+	}
+	if !strings.Contains(shown, "  CLUSTER: base # "+filepath.Join(dir, "base", "gmig.json")) {
+		t.Errorf("missing origin of env in\n%s", shown)
+	}
+}
+
+func TestConfigExtendsCycle(t *testing.T) {
+	dir := t.TempDir()
+	writeConfigFile(t, filepath.Join(dir, "a", "gmig.yaml"), "extends: ../b/gmig.yaml\nproject: a")
+	writeConfigFile(t, filepath.Join(dir, "b", "gmig.yaml"), "extends: ../a\nbucket: b\nstate: b")
+	_, err := TryToLoadConfig(filepath.Join(dir, "a"))
+	if err == nil || !strings.Contains(err.Error(), "cyclic extends") {
+		t.Errorf("got [%v] want cyclic extends error", err)
+	}
+}
+
+func TestConfigExtendsMissing(t *testing.T) {
+	dir := t.TempDir()
+	writeConfigFile(t, filepath.Join(dir, "a", "gmig.yaml"), "extends: ../base\nproject: a\nbucket: b\nstate: s")
+	if _, err := TryToLoadConfig(filepath.Join(dir, "a")); err == nil {
+		t.Error("expected error")
+	}
+}
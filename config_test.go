@@ -3,6 +3,8 @@ package main
 import (
 	"encoding/json"
 	"testing"
+
+	"gopkg.in/yaml.v2"
 )
 
 var cfg = `
@@ -44,3 +46,23 @@ func TestTryToLoadConfig(t *testing.T) {
 	}
 	t.Log(c, err)
 }
+
+func TestEnvironmentValuesAsWritten(t *testing.T) {
+	var c Config
+	if err := yaml.Unmarshal([]byte("env:\n  GKE_VERSION: 1.20\n  ACCOUNT: 012345\n  FLAG: yes\n  ZONES: [a, 1.0]\n  EMPTY:\n"), &c); err != nil {
+		t.Fatal(err)
+	}
+	for k, want := range map[string]string{"GKE_VERSION": "1.20", "ACCOUNT": "012345", "FLAG": "yes", "ZONES": "a,1.0", "EMPTY": ""} {
+		if got := c.EnvironmentVars[k]; got != want {
+			t.Errorf("got [%v] want [%v]", got, want)
+		}
+	}
+	if err := json.Unmarshal([]byte(`{"env":{"SIZE":1000000,"RATIO":1.50,"ON":true}}`), &c); err != nil {
+		t.Fatal(err)
+	}
+	for k, want := range map[string]string{"SIZE": "1000000", "RATIO": "1.50", "ON": "true"} {
+		if got := c.EnvironmentVars[k]; got != want {
+			t.Errorf("got [%v] want [%v]", got, want)
+		}
+	}
+}
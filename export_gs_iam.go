@@ -12,6 +12,20 @@ import (
 
 // ExportStorageIAMPolicy prints a migration that sets IAM for each bucket owned by the project.
 func ExportStorageIAMPolicy(cfg Config) error {
+	content, err := storageIAMPolicyMigration(cfg)
+	if err != nil {
+		return err
+	}
+	// write the migration
+	filename := NewFilenameWithIndex("exported buckets iam policy")
+	if cfg.verbose {
+		log.Println("writing", filename)
+	}
+	return ioutil.WriteFile(filename, content, os.ModePerm)
+}
+
+// storageIAMPolicyMigration returns the contents of a migration with the current IAM bindings of each bucket owned by the project.
+func storageIAMPolicyMigration(cfg Config) ([]byte, error) {
 	// get all buckets
 	cmdline := []string{"gsutil", "list"}
 	if cfg.verbose {
@@ -22,7 +36,7 @@ func ExportStorageIAMPolicy(cfg Config) error {
 	cmd.Stdout = out
 	cmd.Stderr = os.Stderr
 	if err := cmd.Run(); err != nil {
-		return err
+		return nil, err
 	}
 	buckets := strings.Split(strings.TrimSpace(out.String()), "\n")
 
@@ -35,7 +49,7 @@ func ExportStorageIAMPolicy(cfg Config) error {
 	for _, each := range buckets {
 		policy, err := fetchIAMPolicy([]string{"gsutil", "iam", "get", each}, cfg.verbose)
 		if err != nil {
-			return err
+			return nil, err
 		}
 		list = append(list, memberRolesPerBucket{
 			bucket:        each,
@@ -81,11 +95,5 @@ func ExportStorageIAMPolicy(cfg Config) error {
 			}
 		}
 	}
-
-	// write the migration
-	filename := NewFilenameWithIndex("exported buckets iam policy")
-	if cfg.verbose {
-		log.Println("writing", filename)
-	}
-	return ioutil.WriteFile(filename, content.Bytes(), os.ModePerm)
+	return content.Bytes(), nil
 }
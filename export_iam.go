@@ -54,10 +54,23 @@ func fetchIAMPolicy(cmdline []string, verbose bool) (IAMPolicy, error) {
 // and outputs the contents of a gmig migration file.
 // Return the filename of the migration.
 func ExportProjectsIAMPolicy(cfg Config) error {
-	policy, err := fetchIAMPolicy([]string{"gcloud", "projects", "get-iam-policy", cfg.Project, "--format", "json"}, cfg.verbose)
+	content, err := projectsIAMPolicyMigration(cfg)
 	if err != nil {
 		return err
 	}
+	filename := NewFilenameWithIndex("exported project iam policy")
+	if cfg.verbose {
+		log.Println("writing", filename)
+	}
+	return os.WriteFile(filename, content, os.ModePerm)
+}
+
+// projectsIAMPolicyMigration returns the contents of a migration with the current IAM bindings on project level.
+func projectsIAMPolicyMigration(cfg Config) ([]byte, error) {
+	policy, err := fetchIAMPolicy([]string{"gcloud", "projects", "get-iam-policy", cfg.Project, "--format", "json"}, cfg.verbose)
+	if err != nil {
+		return nil, err
+	}
 	memberToRoles := policy.buildMemberToRoles()
 	content := new(bytes.Buffer)
 	fmt.Fprintln(content, "# exported projects iam policy")
@@ -77,9 +90,5 @@ func ExportProjectsIAMPolicy(cfg Config) error {
 			fmt.Fprint(content, cmd)
 		}
 	}
-	filename := NewFilenameWithIndex("exported project iam policy")
-	if cfg.verbose {
-		log.Println("writing", filename)
-	}
-	return os.WriteFile(filename, content.Bytes(), os.ModePerm)
+	return content.Bytes(), nil
 }
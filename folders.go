@@ -0,0 +1,118 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// collectMigrationFiles returns the filenames of all migrations in the folders, relative to the root,
+// ordered by their name regardless of the folder they are in.
+// Subfolders are searched too, except those for modules and templates, hidden ones and those with a gmig configuration.
+// If no folders are given then only the root itself is searched.
+func collectMigrationFiles(root string, folders []string) ([]string, error) {
+	root, err := filepath.Abs(root)
+	if err != nil {
+		return nil, err
+	}
+	recursive := len(folders) > 0
+	if !recursive {
+		folders = []string{"."}
+	}
+	// name -> relative filename
+	seen := map[string]string{}
+	filenames := []string{}
+	for _, folder := range folders {
+		start := filepath.Clean(folder)
+		if !filepath.IsAbs(start) {
+			start = filepath.Join(root, folder)
+		}
+		err := filepath.WalkDir(start, func(path string, entry fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if entry.IsDir() {
+				if path != start && (!recursive || isIgnoredFolder(path)) {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if !isMigrationFileIn(entry.Name(), !recursive) {
+				return nil
+			}
+			rel, err := filepath.Rel(root, path)
+			if err != nil {
+				return err
+			}
+			rel = filepath.ToSlash(rel)
+			if other, ok := seen[entry.Name()]; ok {
+				if other == rel {
+					// folders overlap
+					return nil
+				}
+				return fmt.Errorf("duplicate migration name [%s] in [%s] and [%s]", entry.Name(), other, rel)
+			}
+			seen[entry.Name()] = rel
+			filenames = append(filenames, rel)
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("unable to read migrations from folder [%s]: %v", folder, err)
+		}
+	}
+	// old -> new
+	sort.Slice(filenames, func(i, j int) bool {
+		return sortsBefore(filenames[i], filenames[j])
+	})
+	return filenames, nil
+}
+
+// isIgnoredFolder returns true if the folder cannot contain migrations.
+func isIgnoredFolder(path string) bool {
+	name := filepath.Base(path)
+	if name == "modules" || name == defaultTemplatesFolder || name == defaultArchiveFolder || strings.HasPrefix(name, ".") {
+		return true
+	}
+	for _, each := range []string{YAMLConfigFilename, ymlConfigFilename, jsonConfigFilename} {
+		if _, err := os.Stat(filepath.Join(path, each)); err == nil {
+			// a target folder
+			return true
+		}
+	}
+	return false
+}
+
+// isMigrationFileIn returns true if the file is a migration.
+// Unless only the migrations path itself is searched, only files with an index or timestamp prefix are migrations
+// such that other files (e.g. Kubernetes manifests) can be stored next to them.
+func isMigrationFileIn(name string, anyYAML bool) bool {
+	if name == YAMLConfigFilename || name == ymlConfigFilename || name == renamesFilename {
+		return false
+	}
+	if !isMigrationFile(name) {
+		return false
+	}
+	return anyYAML || regexpIndex.MatchString(name) || regexpTimestamp.MatchString(name)
+}
+
+// migrationName returns the filename of a migration without its folder ; it determines the global order.
+func migrationName(filename string) string {
+	if len(filename) == 0 {
+		return ""
+	}
+	return filepath.Base(filename)
+}
+
+// sortsBefore returns true if migration a is ordered before migration b.
+// Both can be relative filenames with or without a folder.
+func sortsBefore(a, b string) bool {
+	return migrationName(a) < migrationName(b)
+}
+
+// sameMigration returns true if both filenames, with or without a folder, refer to the same migration.
+func sameMigration(a, b string) bool {
+	return len(a) > 0 && migrationName(a) == migrationName(b)
+}
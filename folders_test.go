@@ -0,0 +1,93 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeTestFiles(t *testing.T, dir string, files ...string) {
+	for _, each := range files {
+		full := filepath.Join(dir, each)
+		if err := os.MkdirAll(filepath.Dir(full), os.ModePerm); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(full, []byte("do:\n- echo "+each), os.ModePerm); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestCollectMigrationFilesTopLevelOnly(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFiles(t, dir, "020_two.yaml", "iam/010_one.yaml")
+	list, err := collectMigrationFiles(dir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := strings.Join(list, ","), "020_two.yaml"; got != want {
+		t.Errorf("got [%v] want [%v]", got, want)
+	}
+}
+
+func TestCollectMigrationFilesFromFolders(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFiles(t, dir,
+		"iam/010_one.yaml",
+		"iam/roles/030_three.yaml",
+		"iam/modules/service-account.yaml",
+		"network/020_two.yaml",
+		"network/firewall.yaml",
+		"network/prod/gmig.yaml",
+		"network/prod/040_four.yaml",
+		"../shared/015_shared.yaml")
+	list, err := collectMigrationFiles(dir, []string{"iam", "network/", "../shared"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "iam/010_one.yaml,../shared/015_shared.yaml,network/020_two.yaml,iam/roles/030_three.yaml"
+	if got := strings.Join(list, ","); got != want {
+		t.Errorf("got [%v] want [%v]", got, want)
+	}
+}
+
+func TestCollectMigrationFilesDuplicateName(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFiles(t, dir, "iam/010_one.yaml", "network/010_one.yaml")
+	_, err := collectMigrationFiles(dir, []string{"iam", "network"})
+	if err == nil {
+		t.Fatal("expected error")
+	}
+	if !strings.Contains(err.Error(), "duplicate") {
+		t.Errorf("got [%v] want duplicate", err)
+	}
+}
+
+func TestLoadMigrationsFromFoldersBetweenAnd(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFiles(t, dir, "iam/010_one.yaml", "network/020_two.yaml", "iam/030_three.yaml")
+	// state written by an older version has no folder
+	list, err := LoadMigrationsFromFoldersBetweenAnd(dir, []string{"iam", "network"}, "010_one.yaml", "network/020_two.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := len(list), 1; got != want {
+		t.Fatalf("got [%v] want [%v]", got, want)
+	}
+	if got, want := list[0].Filename, "network/020_two.yaml"; got != want {
+		t.Errorf("got [%v] want [%v]", got, want)
+	}
+}
+
+func TestSortsBefore(t *testing.T) {
+	if !sortsBefore("network/010_one.yaml", "iam/020_two.yaml") {
+		t.Error("expected order by name regardless of folder")
+	}
+	if !sortsBefore("", "010_one.yaml") {
+		t.Error("expected empty before any")
+	}
+	if !sameMigration("010_one.yaml", "iam/010_one.yaml") {
+		t.Error("expected same migration")
+	}
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+)
+
+// Foreach holds the items to iterate over when running a section,
+// either listed inline or taken from the value of a variable.
+type Foreach struct {
+	Items    []string
+	Variable string
+}
+
+// UnmarshalYAML accepts either a list of items or the name of a variable.
+func (f *Foreach) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var items []string
+	if err := unmarshal(&items); err == nil {
+		f.Items = items
+		return nil
+	}
+	var name string
+	if err := unmarshal(&name); err != nil {
+		return errors.New("foreach must be a list of items or the name of a variable")
+	}
+	f.Variable = strings.TrimSuffix(strings.TrimPrefix(strings.TrimPrefix(name, "$"), "{"), "}")
+	return nil
+}
+
+// MarshalYAML implements yaml.Marshaler
+func (f Foreach) MarshalYAML() (interface{}, error) {
+	if len(f.Variable) > 0 {
+		return "$" + f.Variable, nil
+	}
+	return f.Items, nil
+}
+
+// isEmpty returns true if no foreach was specified.
+func (f Foreach) isEmpty() bool {
+	return len(f.Items) == 0 && len(f.Variable) == 0
+}
+
+// items returns the inline items or the items from the variable value separated by comma or whitespace.
+func (f Foreach) items(envs []string) ([]string, error) {
+	if len(f.Variable) == 0 {
+		return f.Items, nil
+	}
+	value, ok := lookupEnv(envs, f.Variable)
+	if !ok {
+		return nil, fmt.Errorf("foreach variable [%s] is not defined", f.Variable)
+	}
+	return strings.FieldsFunc(value, func(r rune) bool {
+		return r == ',' || r == ' ' || r == '\t' || r == '\n'
+	}), nil
+}
+
+// lookupEnv returns the last value of a KEY=value entry.
+func lookupEnv(envs []string, key string) (value string, ok bool) {
+	for _, each := range envs {
+		kv := strings.SplitN(each, "=", 2)
+		if len(kv) == 2 && kv[0] == key {
+			value, ok = kv[1], true
+		}
+	}
+	return
+}
+
+// forEachRun calls fn with the environment for each run of a section of a migration.
+// If the migration has a foreach then $ITEM is set for each run ; for undo, items are visited in reverse order.
+func forEachRun(m Migration, section string, envs []string, fn func(envs []string) error) error {
+	if m.Foreach.isEmpty() {
+		return fn(envs)
+	}
+	items, err := m.Foreach.items(envs)
+	if err != nil {
+		return err
+	}
+	if len(items) == 0 {
+		printWarning("foreach has no items, nothing to run for", section)
+		return nil
+	}
+	if section == "undo" {
+		reversed := make([]string, len(items))
+		for i, each := range items {
+			reversed[len(items)-1-i] = each
+		}
+		items = reversed
+	}
+	for i, each := range items {
+		log.Printf("... %s ITEM=%s (%d/%d)\n", section, each, i+1, len(items))
+		runEnvs := append(append([]string{}, envs...), "ITEM="+each)
+		if err := fn(runEnvs); err != nil {
+			return fmt.Errorf("%s for ITEM=%s failed:%v", section, each, err)
+		}
+	}
+	return nil
+}
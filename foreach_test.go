@@ -0,0 +1,46 @@
+package main
+
+import (
+	"testing"
+
+	"gopkg.in/yaml.v2"
+)
+
+func TestForeachInline(t *testing.T) {
+	var m Migration
+	if err := yaml.Unmarshal([]byte("foreach: [a, b]\nundo:\n- echo $ITEM\n"), &m); err != nil {
+		t.Fatal(err)
+	}
+	visited := []string{}
+	err := forEachRun(m, "undo", []string{}, func(envs []string) error {
+		item, _ := lookupEnv(envs, "ITEM")
+		visited = append(visited, item)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := visited, []string{"b", "a"}; len(got) != 2 || got[0] != want[0] || got[1] != want[1] {
+		t.Errorf("got [%v] want [%v]", got, want)
+	}
+}
+
+func TestForeachVariable(t *testing.T) {
+	var m Migration
+	if err := yaml.Unmarshal([]byte("foreach: $REGIONS\ndo:\n- echo $ITEM\n"), &m); err != nil {
+		t.Fatal(err)
+	}
+	items, err := m.Foreach.items([]string{"REGIONS=europe-west1, us-central1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := len(items), 2; got != want {
+		t.Fatalf("got [%v] want [%v]", got, want)
+	}
+	if got, want := items[1], "us-central1"; got != want {
+		t.Errorf("got [%v] want [%v]", got, want)
+	}
+	if _, err := m.Foreach.items([]string{}); err == nil {
+		t.Error("expected error for undefined variable")
+	}
+}
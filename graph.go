@@ -0,0 +1,177 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/urfave/cli"
+)
+
+// validateRequirements checks that all required migrations exist, that there are no cycles
+// and that each required migration sorts before the migration that requires it.
+// Archived migrations, by name, can be required too.
+func validateRequirements(all []Migration, archived ...string) error {
+	byName := map[string]Migration{}
+	for _, each := range all {
+		byName[migrationName(each.Filename)] = each
+	}
+	isArchivedName := map[string]bool{}
+	for _, each := range archived {
+		isArchivedName[each] = true
+	}
+	for _, each := range all {
+		for _, other := range each.Requires {
+			if _, ok := byName[migrationName(other)]; !ok && !isArchivedName[migrationName(other)] {
+				return fmt.Errorf("migration [%s] requires unknown migration [%s]", each.Filename, other)
+			}
+		}
+	}
+	// detect cycles using depth-first search
+	const (
+		visiting = 1
+		visited  = 2
+	)
+	marks := map[string]int{}
+	var visit func(name string, path []string) error
+	visit = func(name string, path []string) error {
+		switch marks[name] {
+		case visiting:
+			return fmt.Errorf("cyclic requirements [%s]", strings.Join(append(path, name), " -> "))
+		case visited:
+			return nil
+		}
+		marks[name] = visiting
+		for _, other := range byName[name].Requires {
+			if err := visit(migrationName(other), append(path, name)); err != nil {
+				return err
+			}
+		}
+		marks[name] = visited
+		return nil
+	}
+	for _, each := range all {
+		if err := visit(migrationName(each.Filename), []string{}); err != nil {
+			return err
+		}
+	}
+	// requirements must be consistent with the filename ordering
+	for _, each := range all {
+		for _, other := range each.Requires {
+			if !sortsBefore(other, each.Filename) {
+				return fmt.Errorf("migration [%s] requires [%s] which is ordered after it", each.Filename, other)
+			}
+		}
+	}
+	return nil
+}
+
+// isApplied returns true if the migration is applied to the target and was not skipped by its condition.
+func (m migrationContext) isApplied(mig Migration) bool {
+	if sortsBefore(m.lastApplied, mig.Filename) {
+		return false
+	}
+	// an if_command tells about the current infrastructure, not about when it was applied
+	pass, err := m.condition(mig).evaluateExpression(m.migrationEnv(mig, "do"))
+	return err == nil && pass
+}
+
+// checkRequirementsApplied returns an error if one of the required migrations is not applied.
+func (m migrationContext) checkRequirementsApplied(mig Migration, all []Migration) error {
+	for _, other := range all {
+		for _, each := range mig.Requires {
+			if sameMigration(each, other.Filename) && !m.isApplied(other) {
+				return fmt.Errorf("migration [%s] requires [%s] which is not applied", mig.Filename, each)
+			}
+		}
+	}
+	return nil
+}
+
+// checkNotRequired returns an error if an applied migration requires the given one.
+func (m migrationContext) checkNotRequired(mig Migration, all []Migration) error {
+	for _, other := range all {
+		if sameMigration(other.Filename, mig.Filename) || !m.isApplied(other) {
+			continue
+		}
+		for _, each := range other.Requires {
+			if sameMigration(each, mig.Filename) {
+				return fmt.Errorf("migration [%s] is required by applied migration [%s]", mig.Filename, other.Filename)
+			}
+		}
+	}
+	return nil
+}
+
+// writeGraphText writes each migration followed by the migrations it requires.
+func writeGraphText(w io.Writer, all []Migration, isApplied func(Migration) bool) {
+	for _, each := range all {
+		status := pending
+		if isApplied(each) {
+			status = applied
+		}
+		fmt.Fprintf(w, "%s %s\n", status, each.Filename)
+		for _, other := range each.Requires {
+			fmt.Fprintf(w, "                  requires %s\n", other)
+		}
+	}
+}
+
+// writeGraphDot writes the migrations in Graphviz dot format with edges from required to requiring migrations.
+func writeGraphDot(w io.Writer, all []Migration, isApplied func(Migration) bool) {
+	fmt.Fprintln(w, "digraph migrations {")
+	fmt.Fprintln(w, "\trankdir=LR;")
+	fmt.Fprintln(w, "\tnode [shape=box];")
+	for _, each := range all {
+		style := "dashed"
+		if isApplied(each) {
+			style = "solid"
+		}
+		fmt.Fprintf(w, "\t%q [style=%s];\n", each.Filename, style)
+	}
+	filenames := map[string]string{}
+	for _, each := range all {
+		filenames[migrationName(each.Filename)] = each.Filename
+	}
+	for _, each := range all {
+		for _, other := range each.Requires {
+			if filename, ok := filenames[migrationName(other)]; ok {
+				other = filename
+			}
+			fmt.Fprintf(w, "\t%q -> %q;\n", other, each.Filename)
+		}
+	}
+	fmt.Fprintln(w, "}")
+}
+
+func cmdGraph(c *cli.Context) error {
+	mtx, err := getMigrationContext(c)
+	if err != nil {
+		printError(err.Error())
+		return errAbort
+	}
+	all, err := mtx.loadMigrationsBetweenAnd("", "")
+	if err != nil {
+		printError(err.Error())
+		return errAbort
+	}
+	archived, err := mtx.archivedNames()
+	if err != nil {
+		printError(err.Error())
+		return errAbort
+	}
+	if err := validateRequirements(all, archived...); err != nil {
+		printError(err.Error())
+		return errAbort
+	}
+	if c.Bool("dot") {
+		writeGraphDot(os.Stdout, all, mtx.isApplied)
+		return nil
+	}
+	log.Println(statusSeparator)
+	writeGraphText(os.Stdout, all, mtx.isApplied)
+	log.Println(statusSeparator)
+	return nil
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestValidateRequirements(t *testing.T) {
+	all := []Migration{
+		{Filename: "010_one.yaml"},
+		{Filename: "020_two.yaml", Requires: []string{"010_one.yaml"}},
+	}
+	if err := validateRequirements(all); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestValidateRequirementsUnknown(t *testing.T) {
+	all := []Migration{
+		{Filename: "020_two.yaml", Requires: []string{"010_one.yaml"}},
+	}
+	if err := validateRequirements(all); err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+func TestValidateRequirementsCycle(t *testing.T) {
+	all := []Migration{
+		{Filename: "010_one.yaml", Requires: []string{"020_two.yaml"}},
+		{Filename: "020_two.yaml", Requires: []string{"010_one.yaml"}},
+	}
+	err := validateRequirements(all)
+	if err == nil {
+		t.Fatal("expected error")
+	}
+	if !strings.Contains(err.Error(), "cyclic") {
+		t.Errorf("got [%v] want cyclic", err)
+	}
+}
+
+func TestValidateRequirementsOrder(t *testing.T) {
+	all := []Migration{
+		{Filename: "010_one.yaml", Requires: []string{"020_two.yaml"}},
+		{Filename: "020_two.yaml"},
+	}
+	if err := validateRequirements(all); err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+func TestCheckRequirementsApplied(t *testing.T) {
+	mtx := migrationContext{
+		stateProvider: NewFileStateProvider(Config{Project: "demo", EnvironmentVars: map[string]string{"ENV": "A"}}),
+		lastApplied:   "020_two.yaml",
+	}
+	all := []Migration{
+		{Filename: "010_one.yaml"},
+		{Filename: "020_two.yaml", IfExpression: `ENV == "B"`},
+		{Filename: "030_three.yaml", Requires: []string{"010_one.yaml"}},
+		{Filename: "040_four.yaml", Requires: []string{"020_two.yaml"}},
+	}
+	if err := mtx.checkRequirementsApplied(all[2], all); err != nil {
+		t.Error(err)
+	}
+	// skipped by condition
+	if err := mtx.checkRequirementsApplied(all[3], all); err == nil {
+		t.Error("expected error")
+	}
+	mtx.lastApplied = "030_three.yaml"
+	if err := mtx.checkNotRequired(all[0], all); err == nil {
+		t.Error("expected error")
+	}
+}
+
+func TestWriteGraphDot(t *testing.T) {
+	all := []Migration{
+		{Filename: "010_one.yaml"},
+		{Filename: "020_two.yaml", Requires: []string{"010_one.yaml"}},
+	}
+	buf := new(bytes.Buffer)
+	writeGraphDot(buf, all, func(m Migration) bool { return m.Filename == "010_one.yaml" })
+	if got, want := buf.String(), `"010_one.yaml" -> "020_two.yaml";`; !strings.Contains(got, want) {
+		t.Errorf("got [%v] want [%v]", got, want)
+	}
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+
+	"github.com/urfave/cli"
+)
+
+// historyInfo returns the title, owner and ticket of a history entry for logging.
+func (h HistoryEntry) historyInfo() string {
+	info := Migration{Description: h.Description}.titleInfo()
+	if len(h.Owner) > 0 {
+		info += " owner: " + h.Owner
+	}
+	if len(h.Ticket) > 0 {
+		info += " ticket: " + h.Ticket
+	}
+	return info
+}
+
+// appendHistory returns the history with the entry added, keeping only the last entries up to the history of the configuration.
+// The history is returned unchanged if the configuration keeps no history.
+func (m migrationContext) appendHistory(entry HistoryEntry) []HistoryEntry {
+	limit := m.config().History
+	if limit <= 0 {
+		return m.history
+	}
+	history := append(m.history, entry)
+	if len(history) > limit {
+		history = history[len(history)-limit:]
+	}
+	return history
+}
+
+func cmdHistory(c *cli.Context) error {
+	mtx, err := getMigrationContext(c)
+	if err != nil {
+		printError(err.Error())
+		return errAbort
+	}
+	if c.Bool("json") {
+		entries := mtx.history
+		if entries == nil {
+			entries = []HistoryEntry{}
+		}
+		data, _ := json.MarshalIndent(entries, "", "\t")
+		fmt.Println(string(data))
+		return nil
+	}
+	if len(mtx.history) == 0 {
+		log.Println("no history of migrations for this target")
+		return nil
+	}
+	log.Println(statusSeparator)
+	for _, each := range mtx.history {
+		log.Printf("%s %-4s %s (%s)%s\n", each.Time.Local().Format("2006-01-02 15:04:05"), each.Section, pretty(each.Filename), each.Filename, each.historyInfo())
+	}
+	log.Println(statusSeparator)
+	return nil
+}
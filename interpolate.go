@@ -0,0 +1,107 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// regexpReference matches ${NAME} and the escaped $${ that stands for a literal ${.
+var regexpReference = regexp.MustCompile(`\$\$\{|\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// envResolver replaces references in env values by the values of PROJECT, REGION, ZONE or other env keys.
+type envResolver struct {
+	config   *Config
+	resolved map[string]string
+}
+
+// interpolate resolves the references in all env values such that each section of a migration,
+// its condition and export-env see the same values. References are resolved once, when the configuration is loaded.
+func (c *Config) interpolate() error {
+	r := envResolver{config: c, resolved: map[string]string{}}
+	for k := range c.EnvironmentVars {
+		if _, err := r.resolve(k, []string{}); err != nil {
+			return err
+		}
+	}
+	for k, v := range r.resolved {
+		c.EnvironmentVars[k] = v
+	}
+	for k, v := range c.typedEnv {
+		switch typed := v.(type) {
+		case string:
+			c.typedEnv[k] = r.resolved[k]
+		case []interface{}:
+			items := []interface{}{}
+			for _, each := range typed {
+				if text, ok := each.(string); ok {
+					expanded, err := r.expand(k, text, []string{k})
+					if err != nil {
+						return err
+					}
+					each = expanded
+				}
+				items = append(items, each)
+			}
+			c.typedEnv[k] = items
+		}
+	}
+	return nil
+}
+
+// resolve returns the value of an env key with all references replaced.
+// The stack has the keys that are being resolved, to detect cycles.
+func (r envResolver) resolve(key string, stack []string) (string, error) {
+	if v, ok := r.resolved[key]; ok {
+		return v, nil
+	}
+	for _, each := range stack {
+		if each == key {
+			return "", fmt.Errorf("cyclic reference in env [%s]", strings.Join(append(stack, key), " -> "))
+		}
+	}
+	v, err := r.expand(key, r.config.EnvironmentVars[key], append(stack, key))
+	if err != nil {
+		return "", err
+	}
+	r.resolved[key] = v
+	return v, nil
+}
+
+// expand returns the text of the value of an env key with all references to PROJECT, REGION, ZONE and env keys replaced.
+func (r envResolver) expand(key, text string, stack []string) (string, error) {
+	out := new(strings.Builder)
+	last := 0
+	for _, match := range regexpReference.FindAllStringSubmatchIndex(text, -1) {
+		out.WriteString(text[last:match[0]])
+		last = match[1]
+		if match[2] == -1 {
+			// escaped
+			out.WriteString("${")
+			continue
+		}
+		name := text[match[2]:match[3]]
+		if _, ok := r.config.EnvironmentVars[name]; ok {
+			// env overrides, as in the shell environment
+			v, err := r.resolve(name, stack)
+			if err != nil {
+				return "", err
+			}
+			out.WriteString(v)
+			continue
+		}
+		switch name {
+		case "PROJECT":
+			out.WriteString(r.config.Project)
+		case "REGION":
+			out.WriteString(r.config.Region)
+		case "ZONE":
+			out.WriteString(r.config.Zone)
+		default:
+			// unknown, such as HOME, is left as written
+			out.WriteString(text[match[0]:match[1]])
+		}
+	}
+	out.WriteString(text[last:])
+	return out.String(), nil
+}
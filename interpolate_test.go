@@ -0,0 +1,105 @@
+package main
+
+import (
+	"bytes"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestInterpolateEnv(t *testing.T) {
+	c := Config{
+		Project: "my-project",
+		Region:  "europe-west1",
+		EnvironmentVars: EnvironmentValues{
+			"CLUSTER":   "${PROJECT}-gke",
+			"NODE_POOL": "${CLUSTER}-pool-${REGION}",
+			"LITERAL":   "$${PROJECT} $PROJECT",
+			"ZONES":     "a,b",
+		},
+		typedEnv: map[string]interface{}{
+			"CLUSTER":   "${PROJECT}-gke",
+			"NODE_POOL": "${CLUSTER}-pool-${REGION}",
+			"LITERAL":   "$${PROJECT} $PROJECT",
+			"ZONES":     []interface{}{"${REGION}-a", 2},
+		},
+	}
+	if err := c.interpolate(); err != nil {
+		t.Fatal(err)
+	}
+	for k, want := range map[string]string{
+		"CLUSTER":   "my-project-gke",
+		"NODE_POOL": "my-project-gke-pool-europe-west1",
+		"LITERAL":   "${PROJECT} $PROJECT",
+	} {
+		if got := c.EnvironmentVars[k]; got != want {
+			t.Errorf("got [%v] want [%v]", got, want)
+		}
+		if got := c.typedEnv[k]; got != want {
+			t.Errorf("got [%v] want [%v]", got, want)
+		}
+	}
+	zones := c.typedEnv["ZONES"].([]interface{})
+	if got, want := zones[0], "europe-west1-a"; got != want {
+		t.Errorf("got [%v] want [%v]", got, want)
+	}
+}
+
+func TestInterpolateEnvErrors(t *testing.T) {
+	for _, each := range []struct {
+		env  EnvironmentValues
+		want string
+	}{
+		{EnvironmentValues{"A": "${B}", "B": "${A}"}, "cyclic reference in env"},
+		{EnvironmentValues{"A": "${A}"}, "cyclic reference in env [A -> A]"},
+	} {
+		c := Config{Project: "p", EnvironmentVars: each.env}
+		err := c.interpolate()
+		if err == nil || !strings.Contains(err.Error(), each.want) {
+			t.Errorf("got [%v] want [%v]", err, each.want)
+		}
+	}
+}
+
+func TestInterpolateEnvLeavesUnknownForShell(t *testing.T) {
+	c := Config{Project: "p", EnvironmentVars: EnvironmentValues{"KEY_FILE": "${HOME}/key.json", "CLUSTER": "${PROJECT}-${SUFFIX}"}}
+	if err := c.interpolate(); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := c.EnvironmentVars["KEY_FILE"], "${HOME}/key.json"; got != want {
+		t.Errorf("got [%v] want [%v]", got, want)
+	}
+	if got, want := c.EnvironmentVars["CLUSTER"], "p-${SUFFIX}"; got != want {
+		t.Errorf("got [%v] want [%v]", got, want)
+	}
+}
+
+func TestInterpolateEnvOfExtendedConfig(t *testing.T) {
+	dir := t.TempDir()
+	writeConfigFile(t, filepath.Join(dir, "base", "gmig.yaml"), "project: base\nbucket: b\nstate: s\nenv:\n  CLUSTER: ${PROJECT}-gke")
+	writeConfigFile(t, filepath.Join(dir, "prod", "gmig.yaml"), "extends: ../base\nproject: prod")
+	cfg, err := TryToLoadConfig(filepath.Join(dir, "prod"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := cfg.EnvironmentVars["CLUSTER"], "prod-gke"; got != want {
+		t.Errorf("got [%v] want [%v]", got, want)
+	}
+	if got, want := expandVarsIn(map[string]string{"CLUSTER": "prod-gke"}, "gcloud container clusters describe ${CLUSTER} $CLUSTER"), "gcloud container clusters describe prod-gke prod-gke"; got != want {
+		t.Errorf("got [%v] want [%v]", got, want)
+	}
+}
+
+func TestLogAllWithValueHavingEquals(t *testing.T) {
+	out := new(bytes.Buffer)
+	log.SetOutput(out)
+	defer log.SetOutput(os.Stderr)
+	if err := LogAll(Condition{}, []string{"gcloud run deploy --set-env-vars ${FLAGS}"}, []string{"FLAGS=A=1,B=2"}, false); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := out.String(), "gcloud run deploy --set-env-vars A=1,B=2"; !strings.Contains(got, want) {
+		t.Errorf("got [%v] want [%v]", got, want)
+	}
+}
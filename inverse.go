@@ -0,0 +1,375 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// UndoRule relates a command that creates a resource to the command that deletes it.
+// Commands are given without their resource, e.g. "gcloud iam service-accounts create".
+type UndoRule struct {
+	Create string `json:"create" yaml:"create"`
+	Delete string `json:"delete" yaml:"delete"`
+	// Describe is the command that shows the resource ; optional.
+	Describe string `json:"describe,omitempty" yaml:"describe,omitempty"`
+	// Keys are the flags that identify the resource together with its name, e.g. --member and --role of a binding.
+	// These are passed to the describe command only if that is a describe verb.
+	Keys []string `json:"keys,omitempty" yaml:"keys,omitempty"`
+	// Email is the format of the email of the resource, if the delete and describe commands require it instead of its name.
+	Email string `json:"email,omitempty" yaml:"email,omitempty"`
+}
+
+// undoRules is the table of known commands and their inverse.
+// If there are multiple rules for the same create command then the first one is preferred.
+// Rules from the configuration (undo_rules) are added to these.
+var undoRules = []UndoRule{
+	{Create: "gcloud iam service-accounts create", Delete: "gcloud iam service-accounts delete", Describe: "gcloud iam service-accounts describe", Email: "%s@$PROJECT.iam.gserviceaccount.com"},
+	{Create: "gcloud iam service-accounts add-iam-policy-binding", Delete: "gcloud iam service-accounts remove-iam-policy-binding", Describe: "gcloud iam service-accounts get-iam-policy", Keys: []string{"--member", "--role"}},
+	{Create: "gcloud iam roles create", Delete: "gcloud iam roles delete", Describe: "gcloud iam roles describe", Keys: []string{"--project", "--organization"}},
+	{Create: "gcloud projects add-iam-policy-binding", Delete: "gcloud projects remove-iam-policy-binding", Describe: "gcloud projects get-iam-policy", Keys: []string{"--member", "--role"}},
+	{Create: "gcloud services enable", Delete: "gcloud services disable"},
+	{Create: "gcloud compute addresses create", Delete: "gcloud compute addresses delete", Describe: "gcloud compute addresses describe"},
+	{Create: "gcloud compute networks create", Delete: "gcloud compute networks delete", Describe: "gcloud compute networks describe"},
+	{Create: "gcloud compute networks subnets create", Delete: "gcloud compute networks subnets delete", Describe: "gcloud compute networks subnets describe"},
+	{Create: "gcloud compute firewall-rules create", Delete: "gcloud compute firewall-rules delete", Describe: "gcloud compute firewall-rules describe"},
+	{Create: "gcloud compute instances create", Delete: "gcloud compute instances delete", Describe: "gcloud compute instances describe"},
+	{Create: "gcloud compute disks create", Delete: "gcloud compute disks delete", Describe: "gcloud compute disks describe"},
+	{Create: "gcloud compute routers create", Delete: "gcloud compute routers delete", Describe: "gcloud compute routers describe"},
+	{Create: "gcloud compute instance-templates create", Delete: "gcloud compute instance-templates delete", Describe: "gcloud compute instance-templates describe"},
+	{Create: "gcloud compute health-checks create", Delete: "gcloud compute health-checks delete", Describe: "gcloud compute health-checks describe"},
+	{Create: "gcloud compute backend-services create", Delete: "gcloud compute backend-services delete", Describe: "gcloud compute backend-services describe"},
+	{Create: "gcloud compute url-maps create", Delete: "gcloud compute url-maps delete", Describe: "gcloud compute url-maps describe"},
+	{Create: "gcloud compute target-http-proxies create", Delete: "gcloud compute target-http-proxies delete", Describe: "gcloud compute target-http-proxies describe"},
+	{Create: "gcloud compute target-https-proxies create", Delete: "gcloud compute target-https-proxies delete", Describe: "gcloud compute target-https-proxies describe"},
+	{Create: "gcloud compute forwarding-rules create", Delete: "gcloud compute forwarding-rules delete", Describe: "gcloud compute forwarding-rules describe"},
+	{Create: "gcloud compute ssl-certificates create", Delete: "gcloud compute ssl-certificates delete", Describe: "gcloud compute ssl-certificates describe"},
+	{Create: "gcloud container clusters create", Delete: "gcloud container clusters delete", Describe: "gcloud container clusters describe"},
+	{Create: "gcloud container node-pools create", Delete: "gcloud container node-pools delete", Describe: "gcloud container node-pools describe", Keys: []string{"--cluster"}},
+	{Create: "gcloud sql instances create", Delete: "gcloud sql instances delete", Describe: "gcloud sql instances describe"},
+	{Create: "gcloud sql databases create", Delete: "gcloud sql databases delete", Describe: "gcloud sql databases describe", Keys: []string{"--instance"}},
+	{Create: "gcloud sql users create", Delete: "gcloud sql users delete", Keys: []string{"--instance"}},
+	{Create: "gcloud pubsub topics create", Delete: "gcloud pubsub topics delete", Describe: "gcloud pubsub topics describe"},
+	{Create: "gcloud pubsub subscriptions create", Delete: "gcloud pubsub subscriptions delete", Describe: "gcloud pubsub subscriptions describe"},
+	{Create: "gcloud dns managed-zones create", Delete: "gcloud dns managed-zones delete", Describe: "gcloud dns managed-zones describe"},
+	{Create: "gcloud dns record-sets create", Delete: "gcloud dns record-sets delete", Describe: "gcloud dns record-sets describe", Keys: []string{"--type", "--zone"}},
+	{Create: "gcloud secrets create", Delete: "gcloud secrets delete", Describe: "gcloud secrets describe"},
+	{Create: "gcloud secrets add-iam-policy-binding", Delete: "gcloud secrets remove-iam-policy-binding", Describe: "gcloud secrets get-iam-policy", Keys: []string{"--member", "--role"}},
+	{Create: "gcloud storage buckets create", Delete: "gcloud storage buckets delete", Describe: "gcloud storage buckets describe"},
+	{Create: "gcloud functions deploy", Delete: "gcloud functions delete", Describe: "gcloud functions describe"},
+	{Create: "gcloud run deploy", Delete: "gcloud run services delete", Describe: "gcloud run services describe"},
+	{Create: "gcloud scheduler jobs create", Delete: "gcloud scheduler jobs delete", Describe: "gcloud scheduler jobs describe"},
+	{Create: "gsutil mb", Delete: "gsutil rb", Describe: "gsutil ls -b"},
+	{Create: "gsutil mb", Delete: "gsutil rm -r"},
+}
+
+// resourceCommand is a command that matches a rule.
+type resourceCommand struct {
+	// Command is the part of the rule that matched, e.g. "gcloud iam service-accounts create".
+	Command string
+	// Resource identifies what the command acts on: its name followed by the values of the key flags.
+	Resource string
+}
+
+func (r resourceCommand) String() string {
+	return r.Command + " " + r.Resource
+}
+
+// undoAsymmetries returns a message for each resource that the do section creates but the undo section does not delete,
+// and for each resource that the undo section deletes but the do section does not create.
+func undoAsymmetries(rules []UndoRule, do, undo []string) (missing, extra []string) {
+	created := []resourceCommand{}
+	for _, each := range shellCommands(do) {
+		if _, cmd, ok := matchUndoRule(rules, each, true); ok {
+			created = append(created, cmd)
+		}
+	}
+	deleted := []resourceCommand{}
+	for _, each := range shellCommands(undo) {
+		if _, cmd, ok := matchUndoRule(rules, each, false); ok {
+			deleted = append(deleted, cmd)
+		}
+	}
+	isDeleted := map[int]bool{}
+	for _, each := range created {
+		inverse := resourceCommand{Command: inverseCommand(rules, each.Command), Resource: each.Resource}
+		found := false
+		for i, other := range deleted {
+			if !isDeleted[i] && isInverseOf(rules, each, other) {
+				isDeleted[i] = true
+				found = true
+				break
+			}
+		}
+		if !found {
+			missing = append(missing, fmt.Sprintf("do has [%s] but undo has no [%s]", each, inverse))
+		}
+	}
+	for i, each := range deleted {
+		if !isDeleted[i] {
+			extra = append(extra, fmt.Sprintf("undo has [%s] but do does not create it", each))
+		}
+	}
+	return
+}
+
+// isInverseOf returns true if the delete command removes the resource of the create command.
+func isInverseOf(rules []UndoRule, create, remove resourceCommand) bool {
+	for _, each := range rules {
+		if each.Create == create.Command && each.Delete == remove.Command && sameResource(create.Resource, remove.Resource) {
+			return true
+		}
+	}
+	return false
+}
+
+// sameResource returns true if both identify the same resource.
+// A name also matches an email that starts with it, e.g. the account of a service account.
+func sameResource(a, b string) bool {
+	if a == b {
+		return true
+	}
+	na, ra := splitResource(a)
+	nb, rb := splitResource(b)
+	return ra == rb && (strings.HasPrefix(na, nb+"@") || strings.HasPrefix(nb, na+"@"))
+}
+
+// splitResource returns the name and the key flags of a resource.
+func splitResource(resource string) (name, keys string) {
+	parts := strings.SplitN(resource, " ", 2)
+	if len(parts) == 2 {
+		return parts[0], parts[1]
+	}
+	return parts[0], ""
+}
+
+// scopeFlags locate a resource and are copied from the create command to the proposed delete and describe commands.
+var scopeFlags = []string{"--global", "--region", "--zone", "--location", "--project", "--organization"}
+
+// proposeUndoAndView returns delete commands, in reverse order, and describe commands for the commands of a do section.
+// For commands that are not recognised, the undo has a TODO comment instead.
+func proposeUndoAndView(rules []UndoRule, do []string) (undo, view []string) {
+	for _, each := range shellCommands(do) {
+		rule, cmd, ok := matchUndoRule(rules, each, true)
+		if !ok {
+			undo = append([]string{"# TODO undo: " + each}, undo...)
+			continue
+		}
+		name, keys := splitResource(cmd.Resource)
+		if len(rule.Email) > 0 && !strings.Contains(name, "@") {
+			name = fmt.Sprintf(rule.Email, name)
+		}
+		scope := ""
+		for _, flag := range scopeOf(splitShellWords(each)) {
+			// key flags can also be scope flags
+			if flagName := strings.SplitN(flag, "=", 2)[0]; !strings.Contains(keys, flagName) {
+				scope += " " + flag
+			}
+		}
+		remove := strings.TrimSpace(rule.Delete+" "+name+" "+keys) + scope
+		if strings.HasPrefix(remove, "gcloud ") {
+			remove += " --quiet"
+		}
+		undo = append([]string{remove}, undo...)
+		if len(rule.Describe) == 0 {
+			continue
+		}
+		if strings.HasSuffix(rule.Describe, " describe") {
+			view = append(view, strings.TrimSpace(rule.Describe+" "+name+" "+keys)+scope)
+		} else {
+			view = append(view, rule.Describe+" "+name+scope)
+		}
+	}
+	return
+}
+
+// scopeOf returns the scope flags of a command, e.g. --region=europe-west1.
+func scopeOf(words []string) (scope []string) {
+	for i, each := range words {
+		for _, flag := range scopeFlags {
+			if each == flag {
+				if i+1 < len(words) && !strings.HasPrefix(words[i+1], "-") && flag != "--global" {
+					scope = append(scope, flag+"="+words[i+1])
+				} else {
+					scope = append(scope, flag)
+				}
+			} else if strings.HasPrefix(each, flag+"=") {
+				scope = append(scope, each)
+			}
+		}
+	}
+	return
+}
+
+// inverseCommand returns the delete command for a create command.
+func inverseCommand(rules []UndoRule, create string) string {
+	for _, each := range rules {
+		if each.Create == create {
+			return each.Delete
+		}
+	}
+	return ""
+}
+
+// matchUndoRule returns the rule of which the create (or delete) command matches the command line.
+func matchUndoRule(rules []UndoRule, line string, isCreate bool) (UndoRule, resourceCommand, bool) {
+	tools := map[string]bool{}
+	for _, each := range rules {
+		tools[strings.SplitN(each.Create, " ", 2)[0]] = true
+	}
+	args := commandArgs(splitShellWords(line), tools)
+	best, bestLen := UndoRule{}, 0
+	for _, each := range rules {
+		command := each.Delete
+		if isCreate {
+			command = each.Create
+		}
+		words := strings.Fields(command)
+		// longest match wins, e.g. service-accounts keys create over service-accounts create
+		if len(words) > bestLen && hasWordsPrefix(args, words) {
+			best, bestLen = each, len(words)
+		}
+	}
+	if bestLen == 0 {
+		return best, resourceCommand{}, false
+	}
+	command := best.Delete
+	if isCreate {
+		command = best.Create
+	}
+	return best, resourceCommand{Command: command, Resource: resourceOf(args[bestLen:], best.Keys, args[0] == "gsutil")}, true
+}
+
+// commandArgs returns the words of a command of one of the tools, without global flags and gcloud release tracks.
+func commandArgs(words []string, tools map[string]bool) []string {
+	args := []string{}
+	for i, each := range words {
+		if len(args) == 0 {
+			if tools[each] {
+				args = append(args, each)
+			}
+			// skip env assignments and wrappers such as sudo
+			continue
+		}
+		if len(args) == 1 && (each == "alpha" || each == "beta") && args[0] == "gcloud" {
+			continue
+		}
+		if len(args) == 1 && strings.HasPrefix(each, "-") {
+			// global flag such as --project=x or -q
+			continue
+		}
+		return append(args, words[i:]...)
+	}
+	return args
+}
+
+func hasWordsPrefix(args, words []string) bool {
+	if len(args) < len(words) {
+		return false
+	}
+	for i, each := range words {
+		if args[i] != each {
+			return false
+		}
+	}
+	return true
+}
+
+// resourceOf returns the name of the resource followed by the values of the key flags, in the order of the keys.
+func resourceOf(args []string, keys []string, isGsutil bool) string {
+	name := ""
+	flags := map[string]string{}
+	for i := 0; i < len(args); i++ {
+		each := args[i]
+		if isGsutil {
+			if len(name) == 0 && strings.HasPrefix(each, "gs://") {
+				name = strings.TrimSuffix(each, "/")
+			}
+			continue
+		}
+		if strings.HasPrefix(each, "--") {
+			kv := strings.SplitN(each, "=", 2)
+			if len(kv) == 2 {
+				flags[kv[0]] = kv[1]
+				continue
+			}
+			if i+1 < len(args) && !strings.HasPrefix(args[i+1], "-") {
+				flags[kv[0]] = args[i+1]
+				i++
+			}
+			continue
+		}
+		if strings.HasPrefix(each, "-") {
+			continue
+		}
+		if len(name) == 0 {
+			name = each
+		}
+	}
+	parts := []string{name}
+	for _, each := range keys {
+		if v, ok := flags[each]; ok {
+			parts = append(parts, each+"="+v)
+		}
+	}
+	return strings.TrimSpace(strings.Join(parts, " "))
+}
+
+// shellCommands returns the commands of a section, with continued lines joined and split on ; && and ||.
+func shellCommands(lines []string) (commands []string) {
+	joined := []string{}
+	current := ""
+	for _, each := range lines {
+		trimmed := strings.TrimSpace(each)
+		if strings.HasSuffix(trimmed, "\\") {
+			current += strings.TrimSuffix(trimmed, "\\") + " "
+			continue
+		}
+		joined = append(joined, current+trimmed)
+		current = ""
+	}
+	if len(current) > 0 {
+		joined = append(joined, current)
+	}
+	replacer := strings.NewReplacer("&&", ";", "||", ";")
+	for _, each := range joined {
+		if strings.HasPrefix(each, "#") {
+			continue
+		}
+		for _, cmd := range strings.Split(replacer.Replace(each), ";") {
+			if cmd = strings.TrimSpace(cmd); len(cmd) > 0 {
+				commands = append(commands, cmd)
+			}
+		}
+	}
+	return
+}
+
+// splitShellWords splits a command line into words, keeping quoted text together without its quotes.
+func splitShellWords(line string) (words []string) {
+	var word strings.Builder
+	var quote rune
+	inWord := false
+	for _, r := range line {
+		switch {
+		case quote != 0 && r == quote:
+			quote = 0
+		case quote != 0:
+			word.WriteRune(r)
+		case r == '"' || r == '\'':
+			quote, inWord = r, true
+		case r == ' ' || r == '\t':
+			if inWord {
+				words = append(words, word.String())
+				word.Reset()
+				inWord = false
+			}
+		default:
+			word.WriteRune(r)
+			inWord = true
+		}
+	}
+	if inWord {
+		words = append(words, word.String())
+	}
+	return
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestUndoAsymmetries(t *testing.T) {
+	do := []string{
+		"gcloud iam service-accounts create loadrunner --display-name \"Load Runner\"",
+		"gcloud projects add-iam-policy-binding $PROJECT \\",
+		"  --member serviceAccount:loadrunner@$PROJECT.iam.gserviceaccount.com --role roles/viewer",
+		"gcloud --quiet beta pubsub topics create events && gsutil mb -l EU gs://bucket",
+	}
+	undo := []string{
+		"gcloud projects remove-iam-policy-binding $PROJECT --role=roles/viewer --member=serviceAccount:loadrunner@$PROJECT.iam.gserviceaccount.com",
+		"gcloud iam service-accounts delete loadrunner@$PROJECT.iam.gserviceaccount.com -q",
+		"gsutil rm -r gs://bucket/",
+		"gcloud compute addresses delete lb-ip",
+	}
+	missing, extra := undoAsymmetries(undoRules, do, undo)
+	if got, want := strings.Join(missing, ","), "do has [gcloud pubsub topics create events] but undo has no [gcloud pubsub topics delete events]"; got != want {
+		t.Errorf("got [%v] want [%v]", got, want)
+	}
+	if got, want := strings.Join(extra, ","), "undo has [gcloud compute addresses delete lb-ip] but do does not create it"; got != want {
+		t.Errorf("got [%v] want [%v]", got, want)
+	}
+}
+
+func TestUndoAsymmetriesBindingKeys(t *testing.T) {
+	do := []string{"gcloud projects add-iam-policy-binding demo --member user:a --role roles/viewer"}
+	undo := []string{"gcloud projects remove-iam-policy-binding demo --member user:a --role roles/editor"}
+	missing, _ := undoAsymmetries(undoRules, do, undo)
+	if got, want := len(missing), 1; got != want {
+		t.Errorf("got [%v] want [%v]", got, want)
+	}
+}
+
+func TestUndoAsymmetriesCustomRule(t *testing.T) {
+	rules := append(append([]UndoRule{}, undoRules...), UndoRule{Create: "kubectl create namespace", Delete: "kubectl delete namespace"})
+	missing, _ := undoAsymmetries(rules, []string{"kubectl create namespace demo"}, []string{"echo"})
+	if got, want := len(missing), 1; got != want {
+		t.Errorf("got [%v] want [%v]", got, want)
+	}
+}
+
+func TestSplitShellWords(t *testing.T) {
+	words := splitShellWords(`gcloud iam service-accounts create x --display-name "Load Runner" --description='a b'`)
+	if got, want := strings.Join(words, "|"), "gcloud|iam|service-accounts|create|x|--display-name|Load Runner|--description=a b"; got != want {
+		t.Errorf("got [%v] want [%v]", got, want)
+	}
+}
+
+func TestProposeUndoAndView(t *testing.T) {
+	undo, view := proposeUndoAndView(undoRules, []string{
+		"gcloud iam service-accounts create runner --display-name \"Runner\"",
+		"gcloud compute addresses create my-ip --region europe-west1",
+		"kubectl apply -f app.yaml",
+	})
+	want := []string{
+		"# TODO undo: kubectl apply -f app.yaml",
+		"gcloud compute addresses delete my-ip --region=europe-west1 --quiet",
+		"gcloud iam service-accounts delete runner@$PROJECT.iam.gserviceaccount.com --quiet",
+	}
+	if got, want := strings.Join(undo, "\n"), strings.Join(want, "\n"); got != want {
+		t.Errorf("got [%v] want [%v]", got, want)
+	}
+	want = []string{
+		"gcloud iam service-accounts describe runner@$PROJECT.iam.gserviceaccount.com",
+		"gcloud compute addresses describe my-ip --region=europe-west1",
+	}
+	if got, want := strings.Join(view, "\n"), strings.Join(want, "\n"); got != want {
+		t.Errorf("got [%v] want [%v]", got, want)
+	}
+	// proposed undo must be complete
+	if missing, _ := undoAsymmetries(undoRules, []string{"gcloud iam service-accounts create runner"}, undo); len(missing) > 0 {
+		t.Errorf("got [%v] want none", missing)
+	}
+}
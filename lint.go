@@ -0,0 +1,246 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/urfave/cli"
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	lintError   = "error"
+	lintWarning = "warning"
+)
+
+// lintFinding is a problem found in a migration.
+type lintFinding struct {
+	Filename string `json:"filename"`
+	Level    string `json:"level"`
+	Rule     string `json:"rule"`
+	Message  string `json:"message"`
+}
+
+// lintShellVars are variables that the shell or gmig provide to each section, besides those of the environment.
+var lintShellVars = []string{"HOME", "PATH", "PWD", "OLDPWD", "USER", "SHELL", "TMPDIR", "HOSTNAME", "IFS", "RANDOM", "GMIG_OUTPUTS"}
+
+// regexpShellVar matches $NAME and ${NAME} references.
+var regexpShellVar = regexp.MustCompile(`\$\{?([A-Za-z_][A-Za-z0-9_]*)`)
+
+// regexpShellAssignment matches NAME=, export NAME=, read NAME and for NAME in.
+var regexpShellAssignment = regexp.MustCompile(`(?:^|[;&|(\s])(?:(?:export|local|readonly)\s+)?([A-Za-z_][A-Za-z0-9_]*)=|\bread\s+(?:-\w+\s+)*([A-Za-z_][A-Za-z0-9_]*)|\bfor\s+([A-Za-z_][A-Za-z0-9_]*)\s+in\b`)
+
+// getLintContext returns the context of a target without loading its state, such that no access to Google Cloud is needed.
+func getLintContext(c *cli.Context) (ctx migrationContext, err error) {
+	pathToConfig := c.Args().First()
+	if len(pathToConfig) == 0 {
+		err = fmt.Errorf("missing path containing gmig.yaml in command line")
+		return
+	}
+	cfg, err := TryToLoadConfig(pathToConfig)
+	if err != nil {
+		return
+	}
+	cfg.verbose = c.GlobalBool("v")
+	ctx.stateProvider = NewFileStateProvider(*cfg)
+	ctx.outputs = map[string]map[string]string{}
+	ctx.probes = map[string]bool{}
+	err = ctx.setPaths(c, pathToConfig)
+	return
+}
+
+// lintMigrations returns the findings for all migrations of the target.
+func lintMigrations(mtx migrationContext) ([]lintFinding, error) {
+	filenames, err := collectMigrationFiles(mtx.migrationsPath, mtx.config().Migrations)
+	if err != nil {
+		return nil, err
+	}
+	findings := []lintFinding{}
+	add := func(filename, level, rule, format string, args ...interface{}) {
+		findings = append(findings, lintFinding{Filename: filename, Level: level, Rule: rule, Message: fmt.Sprintf(format, args...)})
+	}
+	rules := append(append([]UndoRule{}, undoRules...), mtx.config().UndoRules...)
+	// names of all outputs, available to migrations that come after
+	outputs := []string{}
+	prefixes := map[string]string{}
+	for _, each := range filenames {
+		prefix := migrationPrefix(each)
+		if len(prefix) == 0 {
+			add(each, lintWarning, "filename", "filename has neither an index (e.g. 010_) nor a timestamp (e.g. 20060102t150405_) prefix")
+		} else {
+			if other, ok := prefixes[prefix]; ok {
+				add(each, lintError, "duplicate-index", "index [%s] is also used by [%s]", prefix, other)
+			} else {
+				prefixes[prefix] = each
+			}
+		}
+		full := filepath.Join(mtx.migrationsPath, each)
+		if !isMarkdownFile(each) {
+			data, err := os.ReadFile(full)
+			if err != nil {
+				return nil, err
+			}
+			if err := yaml.UnmarshalStrict(data, new(Migration)); err != nil {
+				if typeErr, ok := err.(*yaml.TypeError); ok {
+					for _, msg := range typeErr.Errors {
+						add(each, lintError, "unknown-key", "%s", msg)
+					}
+				} else {
+					add(each, lintError, "parse", "%v", err)
+					continue
+				}
+			}
+		}
+		m, err := LoadMigration(full)
+		if err != nil {
+			add(each, lintError, "parse", "%v", err)
+			continue
+		}
+		m.Filename = each
+		if m, err = mtx.prepare(m); err != nil {
+			add(each, lintError, "template", "%v", err)
+			continue
+		}
+		if isEmptySection(m.UndoSection) {
+			add(each, lintWarning, "missing-undo", "undo section is missing or empty")
+		} else {
+			missing, extra := undoAsymmetries(rules, m.DoSection, m.UndoSection)
+			for _, msg := range missing {
+				add(each, lintError, "undo-incomplete", "%s", msg)
+			}
+			for _, msg := range extra {
+				add(each, lintWarning, "undo-extra", "%s", msg)
+			}
+		}
+		if len(m.IfExpression) > 0 {
+			condition := mtx.condition(m)
+			envs := append(mtx.migrationEnv(m, "do"), "ITEM=")
+			if _, err := condition.compile(condition.expressionEnv(envs)); err != nil {
+				// first line only, without the position marker
+				add(each, lintError, "if", "if expression does not compile: %s", strings.SplitN(err.Error(), "\n", 2)[0])
+			}
+		}
+		for _, name := range undefinedVariables(mtx, m, outputs) {
+			add(each, lintError, "undefined-variable", "$%s is not defined by the configuration or the migration", name)
+		}
+		outputs = append(outputs, m.Outputs...)
+	}
+	return findings, nil
+}
+
+// isEmptySection returns true if the section has no commands.
+func isEmptySection(commands []string) bool {
+	for _, each := range commands {
+		if len(strings.TrimSpace(each)) > 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// withoutSingleQuoted returns the command line without the text between single quotes, which the shell does not expand,
+// e.g. the program of awk '{print $NF}'. Single quotes between double quotes are kept.
+func withoutSingleQuoted(line string) string {
+	out := new(strings.Builder)
+	inSingle, inDouble, escaped := false, false, false
+	for _, r := range line {
+		switch {
+		case inSingle:
+			if r == '\'' {
+				inSingle = false
+			}
+			continue
+		case escaped:
+			escaped = false
+		case r == '\\':
+			escaped = true
+		case r == '"':
+			inDouble = !inDouble
+		case r == '\'' && !inDouble:
+			inSingle = true
+			continue
+		}
+		out.WriteRune(r)
+	}
+	return out.String()
+}
+
+// undefinedVariables returns the sorted names of variables used in the sections of a migration
+// that are not defined by the configuration, the migration, the shell or the commands themselves.
+func undefinedVariables(mtx migrationContext, m Migration, outputs []string) []string {
+	defined := map[string]bool{}
+	for _, each := range mtx.migrationEnv(m, "do") {
+		defined[strings.SplitN(each, "=", 2)[0]] = true
+	}
+	for _, each := range append(lintShellVars, outputs...) {
+		defined[each] = true
+	}
+	if !m.Foreach.isEmpty() {
+		defined["ITEM"] = true
+	}
+	sections := [][]string{m.DoSection, m.UndoSection, m.ViewSection, m.PrecheckSection, m.IfCommand}
+	for _, section := range sections {
+		for _, line := range section {
+			for _, match := range regexpShellAssignment.FindAllStringSubmatch(line, -1) {
+				for _, name := range match[1:] {
+					if len(name) > 0 {
+						defined[name] = true
+					}
+				}
+			}
+		}
+	}
+	undefined := map[string]bool{}
+	for _, section := range sections {
+		for _, line := range section {
+			for _, match := range regexpShellVar.FindAllStringSubmatch(withoutSingleQuoted(line), -1) {
+				if !defined[match[1]] {
+					undefined[match[1]] = true
+				}
+			}
+		}
+	}
+	names := []string{}
+	for each := range undefined {
+		names = append(names, each)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func cmdLint(c *cli.Context) error {
+	mtx, err := getLintContext(c)
+	if err != nil {
+		printError(err.Error())
+		return errAbort
+	}
+	findings, err := lintMigrations(mtx)
+	if err != nil {
+		printError(err.Error())
+		return errAbort
+	}
+	errors := 0
+	for _, each := range findings {
+		if each.Level == lintError {
+			errors++
+		}
+	}
+	if c.Bool("json") {
+		data, _ := json.MarshalIndent(findings, "", "\t")
+		fmt.Println(string(data))
+	} else {
+		for _, each := range findings {
+			fmt.Printf("%s:%s: %s (%s)\n", each.Filename, each.Level, each.Message, each.Rule)
+		}
+		fmt.Printf("%d error(s), %d warning(s)\n", errors, len(findings)-errors)
+	}
+	if errors > 0 {
+		return errAbort
+	}
+	return nil
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func lintTestContext(t *testing.T, files map[string]string) migrationContext {
+	dir := t.TempDir()
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), os.ModePerm); err != nil {
+			t.Fatal(err)
+		}
+	}
+	cfg := Config{Project: "demo", EnvironmentVars: EnvironmentValues{"CLUSTER": "one"}}
+	return migrationContext{
+		stateProvider:     NewFileStateProvider(cfg),
+		migrationsPath:    dir,
+		configurationPath: filepath.Join(dir, "demo"),
+		outputs:           map[string]map[string]string{},
+		probes:            map[string]bool{},
+	}
+}
+
+func TestLintMigrations(t *testing.T) {
+	mtx := lintTestContext(t, map[string]string{
+		"010_one.yaml":      "do:\n- echo $CLUSTER\nundo:\n- echo $CLUSTER\noutputs: [IP]\n",
+		"010_two.yaml":      "do:\n- echo $IP\nudno:\n- echo\n",
+		"create_three.yaml": "if: PROJECT ==\ndo:\n- NAME=x; echo $NAME $MISSING\nundo:\n- echo\n",
+	})
+	findings, err := lintMigrations(mtx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rules := []string{}
+	for _, each := range findings {
+		rules = append(rules, each.Filename+":"+each.Rule)
+	}
+	want := []string{
+		"010_two.yaml:duplicate-index",
+		"010_two.yaml:unknown-key",
+		"010_two.yaml:missing-undo",
+		"create_three.yaml:filename",
+		"create_three.yaml:if",
+		"create_three.yaml:undefined-variable",
+	}
+	if got, want := strings.Join(rules, ","), strings.Join(want, ","); got != want {
+		t.Errorf("got [%v] want [%v]", got, want)
+	}
+}
+
+func TestUndefinedVariables(t *testing.T) {
+	mtx := lintTestContext(t, nil)
+	m := Migration{
+		Foreach:   Foreach{Items: []string{"a"}},
+		DoSection: []string{"for zone in a b; do echo $zone; done", "read -r ANSWER", "echo ${ITEM} $PROJECT $ANSWER $GMIG_TARGET ${UNKNOWN}"},
+	}
+	if got, want := strings.Join(undefinedVariables(mtx, m, nil), ","), "UNKNOWN"; got != want {
+		t.Errorf("got [%v] want [%v]", got, want)
+	}
+}
+
+func TestUndefinedVariablesInSingleQuotes(t *testing.T) {
+	mtx := lintTestContext(t, nil)
+	m := Migration{
+		DoSection: []string{
+			`gcloud compute instances list | awk '{print $NF, $1}'`,
+			`gcloud sql instances list --format json | jq -r '.[] | $name' --arg name x`,
+			`echo "it's $UNQUOTED" \'$ESCAPED`},
+	}
+	if got, want := strings.Join(undefinedVariables(mtx, m, nil), ","), "ESCAPED,UNQUOTED"; got != want {
+		t.Errorf("got [%v] want [%v]", got, want)
+	}
+}
+
+func TestLintMigrationsUndoIncomplete(t *testing.T) {
+	mtx := lintTestContext(t, map[string]string{
+		"010_one.yaml": "do:\n- gcloud pubsub topics create events\n- gcloud pubsub subscriptions create worker --topic events\nundo:\n- gcloud pubsub topics delete events\n",
+	})
+	findings, err := lintMigrations(mtx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := len(findings), 1; got != want {
+		t.Fatalf("got [%v] want [%v]", got, want)
+	}
+	if got, want := findings[0].Message, "do has [gcloud pubsub subscriptions create worker] but undo has no [gcloud pubsub subscriptions delete worker]"; got != want {
+		t.Errorf("got [%v] want [%v]", got, want)
+	}
+}
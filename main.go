@@ -44,6 +44,15 @@ func newApp() *cli.App {
 	If not specified then set it to the parent folder of the configuration file.`,
 	}
 
+	tagsFlag := cli.StringFlag{
+		Name:  "tags",
+		Usage: "comma separated tags ; only migrations with one of these tags are run.",
+	}
+	excludeTagsFlag := cli.StringFlag{
+		Name:  "exclude-tags",
+		Usage: "comma separated tags ; migrations with one of these tags are skipped.",
+	}
+
 	app.Commands = []cli.Command{
 		{
 			Name:  "init",
@@ -75,6 +84,31 @@ func newApp() *cli.App {
 					Name:  "view",
 					Usage: "commands to run in the 'view' section of this migration. Multiple commands need to be separated by a newline.",
 				},
+				cli.StringFlag{
+					Name:  "owner",
+					Usage: "who is responsible for this migration",
+				},
+				cli.StringFlag{
+					Name:  "ticket",
+					Usage: "reference to the issue or change request of this migration",
+				},
+				cli.StringFlag{
+					Name:  "template",
+					Usage: "name of a template in the templates folder to create this migration with",
+				},
+				cli.StringSliceFlag{
+					Name:  "set",
+					Usage: "KEY=VALUE for a parameter of the template ; can be repeated",
+				},
+				cli.StringFlag{
+					Name:  "config",
+					Usage: "folder that contains the configuration (gmig.yaml) with the migrations, naming and templates settings",
+				},
+				cli.StringFlag{
+					Name:  "naming",
+					Usage: "index, timestamp or hybrid ; overrides the naming strategy of the configuration",
+				},
+				migrationsFlag,
 			},
 			ArgsUsage: `<title>
 				title - what the effect of this migration is on infrastructure.`,
@@ -86,7 +120,7 @@ func newApp() *cli.App {
 				defer started(c, "plan = log commands of pending migrations")()
 				return cmdMigrationsPlan(c)
 			},
-			Flags: []cli.Flag{migrationsFlag},
+			Flags: []cli.Flag{migrationsFlag, tagsFlag, excludeTagsFlag},
 			ArgsUsage: `<path> [stop] 
 				path - name of the folder that contains the configuration of the target project.
 				stop - (optional) the name of the migration file after which applying migrations will stop.`,
@@ -101,7 +135,7 @@ func newApp() *cli.App {
 				}
 				return cmdMigrationsStatus(c)
 			},
-			Flags: []cli.Flag{migrationsFlag},
+			Flags: []cli.Flag{migrationsFlag, tagsFlag, excludeTagsFlag},
 			ArgsUsage: `<path> [stop] 
 				path - name of the folder that contains the configuration of the target project.
 				stop - (optional) the name of the migration file after which applying migrations will stop.`,
@@ -141,7 +175,10 @@ func newApp() *cli.App {
 				defer started(c, "show status of migrations")()
 				return cmdMigrationsStatus(c)
 			},
-			Flags: []cli.Flag{migrationsFlag},
+			Flags: []cli.Flag{migrationsFlag, tagsFlag, excludeTagsFlag, cli.BoolFlag{
+				Name:  "json",
+				Usage: "print the status of each migration as JSON",
+			}},
 			ArgsUsage: `<path>
 				path - name of the folder that contains the configuration of the target project.`,
 		},
@@ -152,7 +189,7 @@ func newApp() *cli.App {
 				defer started(c, "show status of infrastructure")()
 				return cmdView(c)
 			},
-			Flags: []cli.Flag{migrationsFlag},
+			Flags: []cli.Flag{migrationsFlag, tagsFlag, excludeTagsFlag},
 			ArgsUsage: `<path>
 				path - name of the folder that contains the configuration of the target project.`,
 		},
@@ -163,6 +200,151 @@ func newApp() *cli.App {
 				defer started(c, "export environment variables")()
 				return cmdExportEnv(c)
 			},
+			Flags: []cli.Flag{migrationsFlag, cli.BoolFlag{
+				Name:  "outputs",
+				Usage: "also export the outputs captured from applied migrations, which reads the state from the bucket",
+			}},
+			ArgsUsage: `<path>
+				path - name of the folder that contains the configuration of the target project.`,
+		},
+		{
+			Name:  "graph",
+			Usage: "Show the requirements between migrations as text or in Graphviz dot format.",
+			Action: func(c *cli.Context) error {
+				defer started(c, "show graph of migrations")()
+				return cmdGraph(c)
+			},
+			Flags: []cli.Flag{migrationsFlag, cli.BoolFlag{
+				Name:  "dot",
+				Usage: "print the graph in Graphviz dot format",
+			}},
+			ArgsUsage: `<path>
+				path - name of the folder that contains the configuration of the target project.`,
+		},
+		{
+			Name:  "lint",
+			Usage: "Check all migrations for common mistakes ; exits with a non-zero code if errors are found.",
+			Action: func(c *cli.Context) error {
+				defer started(c, "lint migrations")()
+				return cmdLint(c)
+			},
+			Flags: []cli.Flag{migrationsFlag, cli.BoolFlag{
+				Name:  "json",
+				Usage: "print the findings as JSON",
+			}},
+			ArgsUsage: `<path>
+				path - name of the folder that contains the configuration of the target project.`,
+		},
+		{
+			Name:  "renumber",
+			Usage: "Rename all migrations to have an index with the same step in between, keeping their order ; shows the renames unless --apply is given.",
+			Action: func(c *cli.Context) error {
+				defer started(c, "renumber migrations")()
+				return cmdRenumber(c)
+			},
+			Flags: []cli.Flag{
+				migrationsFlag,
+				cli.StringFlag{
+					Name:  "config",
+					Usage: "folder that contains the configuration (gmig.yaml) with the migrations setting",
+				},
+				cli.IntFlag{
+					Name:  "step",
+					Usage: "difference between the indexes of subsequent migrations",
+					Value: 10,
+				},
+				cli.BoolFlag{
+					Name:  "apply",
+					Usage: "rename the files and record the renames in renames.yaml",
+				},
+			},
+		},
+		{
+			Name:  "squash",
+			Usage: "Replace all migrations until a given one by a baseline migration and move them into the archive folder ; shows the baseline unless --apply is given.",
+			Action: func(c *cli.Context) error {
+				defer started(c, "squash migrations")()
+				return cmdSquash(c)
+			},
+			Flags: []cli.Flag{
+				migrationsFlag,
+				cli.StringFlag{
+					Name:  "until",
+					Usage: "filename of the last migration to squash ; it must be applied to the target",
+				},
+				cli.BoolFlag{
+					Name:  "export",
+					Usage: "use the exported IAM policies of the target instead of combining the do sections",
+				},
+				cli.BoolFlag{
+					Name:  "apply",
+					Usage: "write the baseline, archive the squashed migrations and record the rename in renames.yaml",
+				},
+			},
+			ArgsUsage: `<path>
+				path - name of the folder that contains the configuration of the target project.`,
+		},
+		{
+			Name:  "archive",
+			Usage: "Move all migrations before a given one into the archive folder ; shows them unless --apply is given.",
+			Action: func(c *cli.Context) error {
+				defer started(c, "archive migrations")()
+				return cmdArchive(c)
+			},
+			Flags: []cli.Flag{
+				migrationsFlag,
+				cli.StringFlag{
+					Name:  "before",
+					Usage: "filename of the first migration that is not archived ; those before it must be applied to the target",
+				},
+				cli.BoolFlag{
+					Name:  "apply",
+					Usage: "move the migrations into the archive folder",
+				},
+			},
+			ArgsUsage: `<path>
+				path - name of the folder that contains the configuration of the target project.`,
+		},
+		{
+			Name:  "config",
+			Usage: "Inspect the configuration of a target {show}",
+			Subcommands: []cli.Command{
+				{
+					Name:  "show",
+					Usage: "Print the effective configuration, including those it extends, and which file has set each value.",
+					Action: func(c *cli.Context) error {
+						return cmdConfigShow(c)
+					},
+					Flags: []cli.Flag{cli.BoolFlag{
+						Name:  "json",
+						Usage: "print the effective configuration as JSON, without the files",
+					}},
+					ArgsUsage: `<path>
+					path - name of the folder that contains the configuration of the target project.`,
+				},
+			},
+		},
+		{
+			Name:  "history",
+			Usage: "List the do and undo sections of migrations that were run for the target, oldest first.",
+			Action: func(c *cli.Context) error {
+				defer started(c, "show history of migrations")()
+				return cmdHistory(c)
+			},
+			Flags: []cli.Flag{migrationsFlag, cli.BoolFlag{
+				Name:  "json",
+				Usage: "print the history as JSON",
+			}},
+			ArgsUsage: `<path>
+				path - name of the folder that contains the configuration of the target project.`,
+		},
+		{
+			Name:  "outputs",
+			Usage: "List the outputs captured from the do section of applied migrations.",
+			Action: func(c *cli.Context) error {
+				defer started(c, "list outputs of applied migrations")()
+				return cmdOutputs(c)
+			},
 			Flags: []cli.Flag{migrationsFlag},
 			ArgsUsage: `<path>
 				path - name of the folder that contains the configuration of the target project.`,
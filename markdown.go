@@ -0,0 +1,143 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// isMarkdownFile returns true if the filename has a Markdown extension.
+func isMarkdownFile(filename string) bool {
+	ext := filepath.Ext(filename)
+	return ext == ".md" || ext == ".markdown"
+}
+
+// isMigrationFile returns true for YAML files and for Markdown files with an index or timestamp prefix,
+// such that other documentation (e.g. README.md) in the migrations folder is ignored.
+func isMigrationFile(filename string) bool {
+	if isYamlFile(filename) {
+		return true
+	}
+	base := filepath.Base(filename)
+	return isMarkdownFile(base) && (regexpIndex.MatchString(base) || regexpTimestamp.MatchString(base))
+}
+
+// parseMarkdownMigration reads a migration from Markdown text.
+// Fenced code blocks tagged do, undo, view, precheck and if_command hold the commands of that section
+// and a block tagged if holds the expression. A block tagged yaml can hold any other field of a migration.
+// All other text is the description, unless the yaml block has one.
+func parseMarkdownMigration(data []byte, m *Migration) error {
+	description := []string{}
+	var block []string
+	var tag string
+	inBlock := false
+	for i, line := range strings.Split(string(data), "\n") {
+		trimmed := strings.TrimSpace(line)
+		isFence := strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~")
+		if !inBlock && isFence {
+			fields := strings.Fields(strings.TrimLeft(trimmed, "`~"))
+			tag = ""
+			if len(fields) > 0 {
+				tag = fields[0]
+			}
+			if !isSectionTag(tag) {
+				// a code block that is part of the description
+				description = append(description, line)
+				tag = ""
+			}
+			inBlock, block = true, []string{}
+			continue
+		}
+		if inBlock && isFence {
+			inBlock = false
+			if len(tag) == 0 {
+				description = append(description, line)
+				continue
+			}
+			if err := m.setMarkdownSection(tag, block); err != nil {
+				return fmt.Errorf("code block ending on line %d: %v", i+1, err)
+			}
+			continue
+		}
+		if inBlock && len(tag) > 0 {
+			block = append(block, line)
+			continue
+		}
+		description = append(description, line)
+	}
+	if inBlock {
+		return fmt.Errorf("code block [%s] is not closed", tag)
+	}
+	if len(m.Description) == 0 {
+		m.Description = strings.TrimSpace(strings.Join(withoutRepeatedEmptyLines(description), "\n"))
+	}
+	return nil
+}
+
+// withoutRepeatedEmptyLines collapses empty lines that are left by removing code blocks.
+func withoutRepeatedEmptyLines(lines []string) (kept []string) {
+	for i, each := range lines {
+		if i > 0 && len(strings.TrimSpace(each)) == 0 && len(strings.TrimSpace(lines[i-1])) == 0 {
+			continue
+		}
+		kept = append(kept, each)
+	}
+	return
+}
+
+func isSectionTag(tag string) bool {
+	switch tag {
+	case "do", "undo", "view", "precheck", "if", "if_command", "yaml":
+		return true
+	}
+	return false
+}
+
+func (m *Migration) setMarkdownSection(tag string, lines []string) error {
+	if tag == "yaml" {
+		return yaml.Unmarshal([]byte(strings.Join(lines, "\n")), m)
+	}
+	if tag == "if" {
+		m.IfExpression = strings.TrimSpace(strings.Join(lines, " "))
+		return nil
+	}
+	commands := []string{}
+	for _, each := range lines {
+		if len(strings.TrimSpace(each)) > 0 {
+			commands = append(commands, each)
+		}
+	}
+	switch tag {
+	case "do":
+		m.DoSection = append(m.DoSection, commands...)
+	case "undo":
+		m.UndoSection = append(m.UndoSection, commands...)
+	case "view":
+		m.ViewSection = append(m.ViewSection, commands...)
+	case "precheck":
+		m.PrecheckSection = append(m.PrecheckSection, commands...)
+	case "if_command":
+		m.IfCommand = append(m.IfCommand, commands...)
+	}
+	return nil
+}
+
+// title returns the first line of the description without Markdown heading markers.
+func (m Migration) title() string {
+	for _, each := range strings.Split(m.Description, "\n") {
+		if t := strings.TrimSpace(strings.TrimLeft(each, "# ")); len(t) > 0 {
+			return t
+		}
+	}
+	return ""
+}
+
+// titleInfo returns the title for logging ; empty if the migration has no description.
+func (m Migration) titleInfo() string {
+	if t := m.title(); len(t) > 0 {
+		return " : " + t
+	}
+	return ""
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadMarkdownMigration(t *testing.T) {
+	m, err := LoadMigration(filepath.Join("examples", "050_create_pubsub_topic_for_events.md"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := m.DoSection[0], "gcloud pubsub topics create events"; got != want {
+		t.Errorf("got [%v] want [%v]", got, want)
+	}
+	if got, want := m.UndoSection[0], "gcloud pubsub topics delete events"; got != want {
+		t.Errorf("got [%v] want [%v]", got, want)
+	}
+	if got, want := m.title(), "Create Pub/Sub topic for events"; got != want {
+		t.Errorf("got [%v] want [%v]", got, want)
+	}
+}
+
+func TestParseMarkdownMigration(t *testing.T) {
+	md := "Some prose.\n\n```yaml\ntags: [iam]\n```\n\n```if\nPROJECT == \"demo\"\n```\n\n```bash\necho example\n```\n\n```do\necho one\n\necho two\n```\n"
+	var m Migration
+	if err := parseMarkdownMigration([]byte(md), &m); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := len(m.DoSection), 2; got != want {
+		t.Errorf("got [%v] want [%v]", got, want)
+	}
+	if got, want := m.IfExpression, `PROJECT == "demo"`; got != want {
+		t.Errorf("got [%v] want [%v]", got, want)
+	}
+	if got, want := m.Tags[0], "iam"; got != want {
+		t.Errorf("got [%v] want [%v]", got, want)
+	}
+	if got, want := m.Description, "Some prose.\n\n```bash\necho example\n```"; got != want {
+		t.Errorf("got [%q] want [%q]", got, want)
+	}
+}
+
+func TestIsMigrationFile(t *testing.T) {
+	for _, each := range []struct {
+		name string
+		ok   bool
+	}{
+		{"010_one.yaml", true},
+		{"010_one.md", true},
+		{"20181026t183700_one.md", true},
+		{"README.md", false},
+		{"notes.txt", false},
+	} {
+		if got, want := isMigrationFile(each.name), each.ok; got != want {
+			t.Errorf("%s: got [%v] want [%v]", each.name, got, want)
+		}
+	}
+}
@@ -2,7 +2,6 @@ package main
 
 import (
 	"bytes"
-	"errors"
 	"fmt"
 	"io/ioutil"
 	"log"
@@ -10,54 +9,43 @@ import (
 	"os/exec"
 	"path"
 	"path/filepath"
-	"sort"
-	"strconv"
 	"strings"
 	"time"
 
 	"text/template"
 
-	"github.com/expr-lang/expr"
 	"gopkg.in/yaml.v2"
 )
 
 // Migration holds shell commands for applying or reverting a change.
 type Migration struct {
-	Filename     string   `yaml:"-"`
-	Description  string   `yaml:"-"`
-	IfExpression string   `yaml:"if"`
-	DoSection    []string `yaml:"do"`
-	UndoSection  []string `yaml:"undo"`
-	ViewSection  []string `yaml:"view"`
+	Filename        string             `yaml:"-"`
+	Description     string             `yaml:"description"`
+	Owner           string             `yaml:"owner"`
+	Ticket          string             `yaml:"ticket"`
+	IfExpression    string             `yaml:"if"`
+	IfCommand       []string           `yaml:"if_command"` // probe that must exit with code 0, after the if expression
+	Requires        []string           `yaml:"requires"`   // filenames of migrations that must be applied first
+	Tags            []string           `yaml:"tags"`
+	Use             string             `yaml:"use"`  // filename of a module, relative to the migration
+	With            map[string]string  `yaml:"with"` // parameter values for the module
+	PrecheckSection []string           `yaml:"precheck"`
+	EnvironmentVars EnvironmentValues  `yaml:"env"` // merged over those of the configuration
+	Foreach         Foreach            `yaml:"foreach"`
+	Template        bool               `yaml:"template"` // render sections as Go templates
+	DoSection       []string           `yaml:"do"`
+	UndoSection     []string           `yaml:"undo"`
+	ViewSection     []string           `yaml:"view"`
+	Outputs         []string           `yaml:"outputs"`  // names of values that the do section writes to $GMIG_OUTPUTS
+	Targets         map[string]Variant `yaml:"targets"`  // sections per target name or label
+	Squashed        []string           `yaml:"squashed"` // filenames of the migrations that a baseline replaces
+	// variant is the key of the selected Targets entry ; empty if the default sections apply.
+	variant string
 }
 
 // evaluateCondition evaluates the expression to a bool ; report error otherwise.
 func evaluateCondition(ifExpression string, envs []string) (bool, error) {
-	if len(ifExpression) == 0 {
-		return true, nil
-	}
-	envMap := map[string]string{}
-	for _, each := range envs {
-		kv := strings.Split(each, "=")
-		if len(kv) != 2 {
-			continue
-		}
-		k := strings.TrimSpace(kv[0])
-		v := strings.TrimSpace(kv[1])
-		envMap[k] = v
-	}
-	program, err := expr.Compile(ifExpression, expr.Env(envMap))
-	if err != nil {
-		return false, err
-	}
-	output, err := expr.Run(program, envMap)
-	if err != nil {
-		return false, err
-	}
-	if b, ok := output.(bool); ok {
-		return b, nil
-	}
-	return false, errors.New("expression does not evaluate to a boolean")
+	return Condition{Expression: ifExpression}.evaluate(envs)
 }
 
 // for testing
@@ -66,32 +54,15 @@ var timeNow = time.Now
 // NewFilenameWithIndex generates a filename using an index for storing
 // a new migration.
 func NewFilenameWithIndex(desc string) string {
-	all, err := LoadMigrationsBetweenAnd(".", "", "")
+	filename, err := newMigrationFilename(".", nil, Naming{}, desc)
 	if err != nil {
 		printError(err.Error())
 		return ""
 	}
-	sanitized := strings.Replace(strings.ToLower(desc), " ", "_", -1)
-	if len(all) == 0 {
-		return fmt.Sprintf("010_%s.yaml", sanitized)
-	}
-	lastFilename := all[len(all)-1].Filename
-	hasTimestamp := regexpTimestamp.MatchString(lastFilename)
-	hasIndex := regexpIndex.MatchString(lastFilename)
-	if hasIndex {
-		i, err := strconv.Atoi(lastFilename[:3])
-		if err != nil {
-			fmt.Printf("%T, %v", i, i)
-		}
-		return fmt.Sprintf("%03d_%s.yaml", i+5, sanitized)
-	}
-	if hasTimestamp {
-		return fmt.Sprintf("300_%s.yaml", sanitized)
-	}
-	return fmt.Sprintf("010_%s.yaml", sanitized)
+	return filename
 }
 
-// LoadMigration reads and parses a migration from a named file.
+// LoadMigration reads and parses a migration from a named YAML or Markdown file.
 func LoadMigration(absFilename string) (m Migration, err error) {
 	data, err := os.ReadFile(absFilename)
 	if err != nil {
@@ -99,37 +70,130 @@ func LoadMigration(absFilename string) (m Migration, err error) {
 		return m, fmt.Errorf("in %s, %s reading failed: %v", wd, absFilename, err)
 	}
 	m.Filename = filepath.Base(absFilename)
-	err = yaml.Unmarshal(data, &m)
+	if isMarkdownFile(absFilename) {
+		err = parseMarkdownMigration(data, &m)
+	} else {
+		err = yaml.Unmarshal(data, &m)
+		if len(m.Description) == 0 {
+			m.Description = headerComment(data)
+		}
+	}
 	if err != nil {
 		err = fmt.Errorf("%s parsing failed: %v", absFilename, err)
+		return
+	}
+	return expandModule(m, filepath.Dir(absFilename))
+}
+
+// headerComment returns the text of the comment lines at the start of a YAML migration, except its filename.
+// Before description was a field, gmig new wrote it in this comment.
+func headerComment(data []byte) string {
+	lines := []string{}
+	for _, each := range strings.Split(string(data), "\n") {
+		line := strings.TrimSpace(each)
+		if len(line) == 0 && len(lines) == 0 {
+			continue
+		}
+		if !strings.HasPrefix(line, "#") {
+			break
+		}
+		text := strings.TrimSpace(strings.TrimPrefix(line, "#"))
+		if len(text) == 0 || strings.HasPrefix(text, "file:") {
+			continue
+		}
+		lines = append(lines, text)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// logDetails logs the description, owner and ticket if present.
+func (m Migration) logDetails() {
+	if len(m.Description) > 0 {
+		for _, each := range strings.Split(m.Description, "\n") {
+			log.Println("description:", each)
+		}
+	}
+	if len(m.Owner) > 0 {
+		log.Println("owner:", m.Owner)
+	}
+	if len(m.Ticket) > 0 {
+		log.Println("ticket:", m.Ticket)
 	}
-	return
 }
 
 // ToYAML returns the contents of a YAML encoded fixture.
 func (m Migration) ToYAML() ([]byte, error) {
+	return m.toYAMLUsing(migrationTemplate, map[string]string{})
+}
+
+// toYAMLUsing returns the contents of a migration file rendered by a template.
+func (m Migration) toYAMLUsing(tmpl *template.Template, values map[string]string) ([]byte, error) {
 	out := new(bytes.Buffer)
-	err := migrationTemplate.Execute(out, m)
+	err := tmpl.Execute(out, migrationTemplateData{Migration: m, Values: values})
 	return out.Bytes(), err
 }
 
 // ExecuteAll the commands for this migration unless the condition evaluates to false
 // We create a temporary executable file with all commands.
 // This allows for using shell variables in multiple commands.
-func ExecuteAll(ifExpression string, commands []string, envs []string, verbose bool) error {
+func ExecuteAll(condition Condition, commands []string, envs []string, verbose bool) error {
 	// check condition
-	pass, err := evaluateCondition(ifExpression, envs)
+	pass, err := condition.evaluate(envs)
 	if err != nil {
-		log.Printf("unable to evaluate condition [%s] because:%v\n", ifExpression, err)
+		log.Printf("unable to evaluate condition [%s] because:%v\n", condition, err)
 		return errAbort
 	}
 	if !pass {
-		log.Printf(".. skipping ... (%d) commands because %s is false.\n", len(commands), ifExpression)
+		log.Printf(".. skipping ... (%d) commands because %s is false.\n", len(commands), condition)
+		return nil
+	}
+	if len(commands) == 0 {
 		return nil
 	}
+	tempScript, err := writeScript(commands, verbose)
+	if err != nil {
+		return err
+	}
+	defer removeScript(tempScript)
+	cmd := exec.Command("sh", "-c", tempScript)
+	cmd.Env = append(os.Environ(), envs...) // extend, not replace
+	if out, err := runCommand(cmd); err != nil {
+		return fmt.Errorf("failed to run migration section:\n%s\nerror:%v", string(out), err)
+	} else {
+		fmt.Println(string(out))
+	}
+	return nil
+}
+
+// CheckPrecondition runs the precheck commands of a migration unless the condition evaluates to false.
+// If one of the commands fails then the migration is blocked and an error is returned.
+func CheckPrecondition(condition Condition, commands []string, envs []string, verbose bool) error {
 	if len(commands) == 0 {
 		return nil
 	}
+	pass, err := condition.evaluate(envs)
+	if err != nil || !pass {
+		// leave reporting the condition to the section that follows
+		return nil
+	}
+	if err := ExecuteAll(Condition{}, commands, envs, verbose); err != nil {
+		return fmt.Errorf("precheck failed, migration is blocked:%v", err)
+	}
+	return nil
+}
+
+// checkPreconditions runs the precheck section of a migration, for each item if the migration has a foreach.
+func checkPreconditions(m Migration, condition Condition, envs []string, verbose bool) error {
+	if len(m.PrecheckSection) == 0 {
+		return nil
+	}
+	return forEachRun(m, "precheck", envs, func(runEnvs []string) error {
+		return CheckPrecondition(condition, m.PrecheckSection, runEnvs, verbose)
+	})
+}
+
+// writeScript creates a temporary executable file with all commands.
+func writeScript(commands []string, verbose bool) (string, error) {
 	tempScript := path.Join(os.TempDir(), "gmig.sh")
 	content := new(bytes.Buffer)
 	fmt.Fprintln(content, setupShellScript(verbose))
@@ -138,36 +202,30 @@ func ExecuteAll(ifExpression string, commands []string, envs []string, verbose b
 		fmt.Fprintln(content, each)
 	}
 	if err := ioutil.WriteFile(tempScript, content.Bytes(), os.ModePerm); err != nil {
-		return fmt.Errorf("failed to write temporary migration section:%v", err)
+		return tempScript, fmt.Errorf("failed to write temporary migration section:%v", err)
 	}
 	if verbose {
 		log.Println("--- BEGIN gmig.sh:\n", content.String(), "--- END gmig.sh")
 	}
-	defer func() {
-		if err := os.Remove(tempScript); err != nil {
-			log.Printf("warning: failed to remove temporary migration execution script:%s\n", tempScript)
-		}
-	}()
-	cmd := exec.Command("sh", "-c", tempScript)
-	cmd.Env = append(os.Environ(), envs...) // extend, not replace
-	if out, err := runCommand(cmd); err != nil {
-		return fmt.Errorf("failed to run migration section:\n%s\nerror:%v", string(out), err)
-	} else {
-		fmt.Println(string(out))
+	return tempScript, nil
+}
+
+func removeScript(tempScript string) {
+	if err := os.Remove(tempScript); err != nil {
+		log.Printf("warning: failed to remove temporary migration execution script:%s\n", tempScript)
 	}
-	return nil
 }
 
 // LogAll logs expanded commands using the environment variables of both the config and the OS.
-func LogAll(ifExpression string, commands []string, envs []string, verbose bool) error {
+func LogAll(condition Condition, commands []string, envs []string, verbose bool) error {
 	// check condition
-	pass, err := evaluateCondition(ifExpression, envs)
+	pass, err := condition.evaluate(envs)
 	if err != nil {
-		log.Printf("unable to evaluate condition [%s] because:%v\n", ifExpression, err)
+		log.Printf("unable to evaluate condition [%s] because:%v\n", condition, err)
 		return errAbort
 	}
 	if !pass {
-		log.Printf(".. skipping ... (%d) commands because %s is false.\n", len(commands), ifExpression)
+		log.Printf(".. skipping ... (%d) commands because %s is false.\n", len(commands), condition)
 		return nil
 	}
 	if len(commands) == 0 {
@@ -176,7 +234,7 @@ func LogAll(ifExpression string, commands []string, envs []string, verbose bool)
 	allEnv := append(os.Environ(), envs...)
 	envMap := map[string]string{}
 	for _, each := range allEnv {
-		kv := strings.Split(each, "=")
+		kv := strings.SplitN(each, "=", 2)
 		envMap[kv[0]] = kv[1]
 	}
 	for _, each := range commands {
@@ -190,13 +248,7 @@ func expandVarsIn(envs map[string]string, command string) string {
 	// assume no recurse expand
 	expanded := command
 	for k, v := range envs {
-		// if the value itself is a known variable then skip it
-		if strings.HasPrefix(v, "$") {
-			if _, ok := envs[v]; ok {
-				log.Printf("Warning, skipping non-expandable environment var %s=%v\n", k, v)
-				continue
-			}
-		}
+		expanded = strings.Replace(expanded, "${"+k+"}", v, -1)
 		varName := "$" + k
 		expanded = strings.Replace(expanded, varName, v, -1)
 	}
@@ -215,32 +267,26 @@ set -e %s`, flag)
 
 // LoadMigrationsBetweenAnd returns a list of pending Migration <firstFilename..lastFilename]
 func LoadMigrationsBetweenAnd(migrationsPath, firstFilename, lastFilename string) (list []Migration, err error) {
-	// collect all filenames
-	filenames := []string{}
-	// firstFilename and lastFilename are relative to workdir.
-	here, _ := os.Getwd()
-	// change and restore finally
-	if err = os.Chdir(migrationsPath); err != nil {
-		return
-	}
-	defer os.Chdir(here)
-	files, err := os.ReadDir(".")
+	return LoadMigrationsFromFoldersBetweenAnd(migrationsPath, nil, firstFilename, lastFilename)
+}
+
+// LoadMigrationsFromFoldersBetweenAnd returns a list of pending Migration <firstFilename..lastFilename]
+// from the folders relative to the migrationsPath, or from the migrationsPath itself if there are none.
+// The Filename of each Migration is relative to the migrationsPath.
+func LoadMigrationsFromFoldersBetweenAnd(migrationsPath string, folders []string, firstFilename, lastFilename string) (list []Migration, err error) {
+	filenames, err := collectMigrationFiles(migrationsPath, folders)
 	if err != nil {
-		log.Println("unable to read migrations from folder", err)
 		return
 	}
-	for _, each := range files {
-		if each.IsDir() || !isYamlFile(each.Name()) {
-			continue
-		}
-		filenames = append(filenames, each.Name())
-	}
-	// old -> new
-	sort.StringSlice(filenames).Sort()
+	return loadMigrationFilesBetweenAnd(migrationsPath, filenames, firstFilename, lastFilename)
+}
+
+// loadMigrationFilesBetweenAnd returns a list of pending Migration <firstFilename..lastFilename] from the ordered filenames.
+func loadMigrationFilesBetweenAnd(migrationsPath string, filenames []string, firstFilename, lastFilename string) (list []Migration, err error) {
 	// load only pending migrations
 	for _, each := range filenames {
 		// do not include firstFilename
-		if each <= firstFilename {
+		if !sortsBefore(firstFilename, each) {
 			continue
 		}
 		var m Migration
@@ -248,29 +294,54 @@ func LoadMigrationsBetweenAnd(migrationsPath, firstFilename, lastFilename string
 		if err != nil {
 			return
 		}
+		m.Filename = each
 		list = append(list, m)
 		// include lastFilename
 		if len(lastFilename) == 0 {
 			continue
 		}
-		if each == lastFilename {
+		if sameMigration(each, lastFilename) {
 			return
 		}
 	}
 	return
 }
 
-var migrationTemplate = template.Must(template.New("gen").Parse(`
+var migrationTemplate = template.Must(template.New("gen").Funcs(template.FuncMap{"yaml": yamlScalar, "isComment": isComment}).Parse(`
 # {{.Description}}
 #
 # file: {{.Filename}}
 
-do:{{range .DoSection}}
-- {{.}}{{end}}
+description: {{yaml .Description}}{{if .Owner}}
+owner: {{yaml .Owner}}{{end}}{{if .Ticket}}
+ticket: {{yaml .Ticket}}{{end}}{{if .EnvironmentVars}}
+env:{{range $k, $v := .EnvironmentVars}}
+  {{$k}}: {{yaml $v}}{{end}}{{end}}{{if .Outputs}}
+outputs:{{range .Outputs}}
+- {{.}}{{end}}{{end}}{{if .Squashed}}
+squashed:{{range .Squashed}}
+- {{.}}{{end}}{{end}}
 
-undo:{{range .UndoSection}}
-- {{.}}{{end}}
+do:{{range .DoSection}}{{if isComment .}}
+{{.}}{{else}}
+- {{.}}{{end}}{{end}}
 
-view:{{range .ViewSection}}
-- {{.}}{{end}}
+undo:{{range .UndoSection}}{{if isComment .}}
+{{.}}{{else}}
+- {{.}}{{end}}{{end}}
+
+view:{{range .ViewSection}}{{if isComment .}}
+{{.}}{{else}}
+- {{.}}{{end}}{{end}}
 `))
+
+// isComment returns true if the line is a comment instead of a command.
+func isComment(line string) bool {
+	return strings.HasPrefix(strings.TrimSpace(line), "#")
+}
+
+// yamlScalar returns the value encoded as a YAML scalar.
+func yamlScalar(value string) string {
+	data, _ := yaml.Marshal(value)
+	return strings.TrimSpace(string(data))
+}
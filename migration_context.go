@@ -4,13 +4,22 @@ import (
 	"fmt"
 	"log"
 	"path/filepath"
+	"strings"
 
 	"github.com/urfave/cli"
 )
 
 type migrationContext struct {
-	// lastApplied is the filename of last migration, relative to migrationsPath
-	lastApplied   string
+	// lastApplied is the filename of last migration, relative to migrationsPath ; can be without its folder if written by an older version
+	lastApplied string
+	// outputs captured from do sections of applied migrations, per filename
+	outputs map[string]map[string]string
+	// skipped has the probes that have skipped the do section of applied migrations
+	skipped []string
+	// history of the sections that were run for the target
+	history []HistoryEntry
+	// probes caches the results of if_command sections
+	probes        map[string]bool
 	stateProvider StateProvider
 	// folder that contains migrations files
 	migrationsPath string
@@ -32,14 +41,63 @@ func getMigrationContext(c *cli.Context) (ctx migrationContext, err error) {
 	if err != nil {
 		return
 	}
-	lastApplied, err := stateProvider.LoadState()
+	stateData, err := stateProvider.LoadState()
 	if err != nil {
 		return
 	}
+	state, err := parseState(stateData)
+	if err != nil {
+		return
+	}
+	lastApplied := state.LastApplied
 	ctx.stateProvider = stateProvider
+	if err = ctx.setPaths(c, pathToConfig); err != nil {
+		return
+	}
+	ctx.lastApplied = lastApplied
+	ctx.outputs = state.Outputs
+	ctx.skipped = state.Skipped
+	ctx.history = state.History
+	ctx.probes = map[string]bool{}
+	if ctx.outputs == nil {
+		ctx.outputs = map[string]map[string]string{}
+	}
+	if len(lastApplied) > 0 {
+		renames, e := loadRenames(ctx.migrationsPath, ctx.config())
+		if e != nil {
+			err = e
+			return
+		}
+		renamed, e := resolveRename(renames, lastApplied)
+		if e != nil {
+			err = e
+			return
+		}
+		if renamed != lastApplied {
+			printWarning(fmt.Sprintf("last applied migration [%s] was renamed to [%s] ; the state is updated on the next save", lastApplied, renamed))
+			lastApplied = renamed
+		}
+		if ctx.outputs, err = renameOutputs(ctx.outputs, renames); err != nil {
+			return
+		}
+		if ctx.skipped, err = renameSkipped(ctx.skipped, renames); err != nil {
+			return
+		}
+		filename, e := ctx.migrationFile(lastApplied)
+		if e != nil {
+			err = e
+			return
+		}
+		ctx.lastApplied = filename
+	}
+	return
+}
+
+// setPaths sets the location of the configuration and of the migrations, which can be overridden by the migrations flag.
+func (ctx *migrationContext) setPaths(c *cli.Context, pathToConfig string) error {
 	fullPathToConfig, err := filepath.Abs(pathToConfig)
 	if err != nil {
-		return
+		return err
 	}
 	ctx.configurationPath = fullPathToConfig
 	ctx.migrationsPath = filepath.Dir(fullPathToConfig)
@@ -50,22 +108,14 @@ func getMigrationContext(c *cli.Context) (ctx migrationContext, err error) {
 			log.Printf("override migrations path with [%s] from [%s] to [%s] err:[%v]\n", migrationsHolder, ctx.migrationsPath, newPath, perr)
 		}
 		if perr != nil {
-			return
+			return nil
 		}
 		ctx.migrationsPath = newPath
 	}
 	if ctx.config().verbose {
 		log.Println("reading migrations from", ctx.migrationsPath)
 	}
-	ctx.lastApplied = lastApplied
-	if len(lastApplied) > 0 {
-		e := checkExists(filepath.Join(ctx.migrationsPath, lastApplied))
-		if e != nil {
-			err = e
-			return
-		}
-	}
-	return
+	return nil
 }
 
 func (m migrationContext) config() Config {
@@ -75,5 +125,144 @@ func (m migrationContext) config() Config {
 func (m migrationContext) shellEnv() (envs []string) {
 	envs = m.config().shellEnv()
 	envs = append(envs, fmt.Sprintf("%s=%s", "GMIG_CONFIG_DIR", m.configurationPath))
+	envs = append(envs, fmt.Sprintf("%s=%s", "GMIG_MIGRATIONS_DIR", m.migrationsPath))
+	envs = append(envs, fmt.Sprintf("%s=%s", "GMIG_LAST_APPLIED", m.lastApplied))
+	envs = append(envs, fmt.Sprintf("%s=%s", "GMIG_VERSION", Version))
+	envs = append(envs, fmt.Sprintf("%s=%s", "GMIG_TARGET", m.target()))
+	envs = append(envs, State{Outputs: m.outputs}.outputEnv()...)
 	return
 }
+
+// condition returns the if expression of a migration with all values available to it.
+func (m migrationContext) condition(mig Migration) Condition {
+	values := map[string]interface{}{}
+	if m.config().IfTypedEnv {
+		for k, v := range m.config().typedEnv {
+			// migration env overrides
+			if _, ok := mig.EnvironmentVars[k]; !ok {
+				values[k] = v
+			}
+		}
+	}
+	values["TARGET"] = m.target()
+	values["migration"] = map[string]interface{}{
+		"filename":    mig.Filename,
+		"description": mig.Description,
+		"owner":       mig.Owner,
+		"ticket":      mig.Ticket,
+		"requires":    mig.Requires,
+		"tags":        mig.Tags,
+	}
+	return Condition{
+		Expression:     mig.IfExpression,
+		Values:         values,
+		MigrationsPath: m.migrationsPath,
+		OSEnv:          m.config().IfOSEnv,
+		Probe:          mig.IfCommand,
+		Name:           mig.Filename,
+		probes:         m.probes,
+		verbose:        m.config().verbose,
+	}
+}
+
+// undoCondition returns the condition of an applied migration for running its undo section.
+// The if_command is not run because it tells about the current infrastructure, which the do section has changed.
+// Instead, the undo section is skipped if the if_command has skipped the do section when it was applied.
+func (m migrationContext) undoCondition(mig Migration) Condition {
+	condition := m.condition(mig)
+	condition.recorded = true
+	condition.probes = map[string]bool{}
+	for _, each := range m.skipped {
+		nameAndItem := strings.SplitN(each, "|", 2)
+		if len(nameAndItem) == 2 && sameMigration(nameAndItem[0], mig.Filename) {
+			condition.probes[mig.Filename+"|"+nameAndItem[1]] = false
+		}
+	}
+	return condition
+}
+
+// target returns the name of the target from the configuration or else the name of the folder of the configuration.
+func (m migrationContext) target() string {
+	if t := m.config().Target; len(t) > 0 {
+		return t
+	}
+	return filepath.Base(m.configurationPath)
+}
+
+// saveState writes the last applied migration, all captured outputs, the skipped probes and the history.
+func (m migrationContext) saveState() error {
+	return m.stateProvider.SaveState(State{LastApplied: m.lastApplied, Outputs: m.outputs, Skipped: m.skipped, History: m.history}.String())
+}
+
+// migrationEnv returns the shell environment for running a section of a migration.
+// Values from the env of the migration override those of the configuration.
+func (m migrationContext) migrationEnv(mig Migration, section string) (envs []string) {
+	envs = m.shellEnv()
+	for k, v := range mig.EnvironmentVars {
+		envs = append(envs, fmt.Sprintf("%s=%s", k, v))
+	}
+	envs = append(envs, fmt.Sprintf("%s=%s", "GMIG_MIGRATION_FILE", mig.Filename))
+	envs = append(envs, fmt.Sprintf("%s=%s", "GMIG_SECTION", section))
+	return
+}
+
+// loadMigrationsBetweenAnd returns the migrations <firstFilename..lastFilename] as they apply to the target.
+func (m migrationContext) loadMigrationsBetweenAnd(firstFilename, lastFilename string) ([]Migration, error) {
+	filenames, err := m.migrationFiles()
+	if err != nil {
+		return nil, err
+	}
+	list, err := loadMigrationFilesBetweenAnd(m.migrationsPath, filenames, firstFilename, lastFilename)
+	if err != nil {
+		return nil, err
+	}
+	for i, each := range list {
+		if list[i], err = m.prepare(each); err != nil {
+			return nil, err
+		}
+	}
+	return list, nil
+}
+
+// migrationFile returns the filename, relative to the migrations path, of the migration with the same name.
+// This finds a migration that was moved into another folder, or into the archive, after it was recorded in the state.
+func (m migrationContext) migrationFile(filename string) (string, error) {
+	if checkExists(filepath.Join(m.migrationsPath, filename)) == nil {
+		return filename, nil
+	}
+	all, err := collectMigrationFiles(m.migrationsPath, m.config().Migrations)
+	if err != nil {
+		return "", err
+	}
+	for _, each := range all {
+		if sameMigration(each, filename) {
+			return each, nil
+		}
+	}
+	archived, err := archivedMigrationFiles(m.migrationsPath)
+	if err != nil {
+		return "", err
+	}
+	for _, each := range archived {
+		if sameMigration(each, filename) {
+			return each, nil
+		}
+	}
+	return "", checkExists(filepath.Join(m.migrationsPath, filename))
+}
+
+// loadMigration returns the migration, relative to the migrations path, as it applies to the target.
+func (m migrationContext) loadMigration(filename string) (Migration, error) {
+	one, err := LoadMigration(filepath.Join(m.migrationsPath, filename))
+	if err != nil {
+		return one, err
+	}
+	one.Filename = filename
+	return m.prepare(one)
+}
+
+// prepare returns the migration as it applies to the target.
+func (m migrationContext) prepare(mig Migration) (Migration, error) {
+	mig = selectVariant(mig, m.target(), m.config().Labels)
+	return m.render(mig)
+}
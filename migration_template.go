@@ -0,0 +1,74 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+)
+
+// defaultTemplatesFolder is the folder, relative to the migrations path, with the templates for new migrations.
+const defaultTemplatesFolder = "templates"
+
+// migrationTemplateData is available to a template for a new migration.
+type migrationTemplateData struct {
+	Migration
+	// Values are set with --set KEY=VALUE
+	Values map[string]string
+}
+
+// findMigrationTemplate returns the filename of a template in the folder, by its name with or without an extension.
+func findMigrationTemplate(folder, name string) (string, error) {
+	candidates := []string{name}
+	if len(filepath.Ext(name)) == 0 {
+		candidates = []string{name + ".yaml", name + ".yml", name + ".md"}
+	}
+	for _, each := range candidates {
+		full := filepath.Join(folder, each)
+		if checkExists(full) == nil {
+			return full, nil
+		}
+	}
+	abs, _ := filepath.Abs(folder)
+	return "", fmt.Errorf("no such template [%s] in [%s]", name, abs)
+}
+
+// parseSetValues returns the values of KEY=VALUE pairs.
+func parseSetValues(pairs []string) (map[string]string, error) {
+	values := map[string]string{}
+	for _, each := range pairs {
+		kv := strings.SplitN(each, "=", 2)
+		if len(kv) != 2 || len(strings.TrimSpace(kv[0])) == 0 {
+			return nil, fmt.Errorf("invalid --set [%s], must be KEY=VALUE", each)
+		}
+		values[strings.TrimSpace(kv[0])] = kv[1]
+	}
+	return values, nil
+}
+
+// renderMigrationTemplate returns the contents of a new migration using a template file.
+// Use {{param "KEY"}} in a template for a value that must be set.
+func renderMigrationTemplate(filename string, m Migration, values map[string]string) ([]byte, error) {
+	text, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	funcs := template.FuncMap{
+		"env":   os.Getenv,
+		"split": strings.Split,
+		"yaml":  yamlScalar,
+		"param": func(key string) (string, error) {
+			v, ok := values[key]
+			if !ok {
+				return "", fmt.Errorf("missing value for parameter, use --set %s=<value>", key)
+			}
+			return v, nil
+		},
+	}
+	tmpl, err := template.New(filepath.Base(filename)).Funcs(funcs).Option("missingkey=error").Parse(string(text))
+	if err != nil {
+		return nil, fmt.Errorf("%s template parsing failed: %v", filename, err)
+	}
+	return m.toYAMLUsing(tmpl, values)
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRenderMigrationTemplate(t *testing.T) {
+	source, err := findMigrationTemplate("examples/templates", "service-account")
+	if err != nil {
+		t.Fatal(err)
+	}
+	values, err := parseSetValues([]string{"NAME=loadrunner", "ROLE=roles/viewer"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := Migration{Filename: "010_create_loadrunner_account.yaml", Description: "create loadrunner account"}
+	data, err := renderMigrationTemplate(source, m, values)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, m.Filename), data, os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	back, err := LoadMigration(filepath.Join(dir, m.Filename))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := back.Description, m.Description; got != want {
+		t.Errorf("got [%v] want [%v]", got, want)
+	}
+	if got, want := back.DoSection[0], `gcloud iam service-accounts create loadrunner --display-name "loadrunner"`; got != want {
+		t.Errorf("got [%v] want [%v]", got, want)
+	}
+}
+
+func TestRenderMigrationTemplateMissingParameter(t *testing.T) {
+	_, err := renderMigrationTemplate("examples/templates/service-account.yaml", Migration{}, map[string]string{"NAME": "x"})
+	if err == nil {
+		t.Fatal("expected error")
+	}
+	if !strings.Contains(err.Error(), "--set ROLE=") {
+		t.Errorf("got [%v] want --set ROLE=", err)
+	}
+}
+
+func TestParseSetValuesInvalid(t *testing.T) {
+	if _, err := parseSetValues([]string{"NAME"}); err == nil {
+		t.Fatal("expected error")
+	}
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"errors"
 	"io/ioutil"
 	"log"
 	"os"
@@ -121,3 +122,100 @@ func TestMigrationContextWithMigrationsOverride(t *testing.T) {
 	}
 	t.Log(ctx)
 }
+
+func TestCheckPreconditionBlocked(t *testing.T) {
+	cc := new(commandCapturer)
+	cc.err = errors.New("instance not found")
+	runCommand = cc.runCommand
+	err := CheckPrecondition(Condition{}, []string{"gcloud sql instances describe my-db"}, []string{}, false)
+	if err == nil {
+		t.Fatal("expected blocked error")
+	}
+	if got, want := len(cc.args), 1; got != want {
+		t.Errorf("got [%v] want [%v]", got, want)
+	}
+}
+
+func TestCheckPreconditionSkippedByCondition(t *testing.T) {
+	cc := new(commandCapturer)
+	cc.err = errors.New("instance not found")
+	runCommand = cc.runCommand
+	err := CheckPrecondition(Condition{Expression: `ENV == "B"`}, []string{"gcloud sql instances describe my-db"}, []string{"ENV=A"}, false)
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+	if got, want := len(cc.args), 0; got != want {
+		t.Errorf("got [%v] want [%v]", got, want)
+	}
+}
+
+func TestMigrationEnvOverridesConfig(t *testing.T) {
+	mtx := migrationContext{
+		stateProvider:  NewFileStateProvider(Config{Project: "demo", EnvironmentVars: map[string]string{"ENV": "A"}}),
+		migrationsPath: "/here",
+		lastApplied:    "010_one.yaml",
+	}
+	m := Migration{Filename: "020_two.yaml", EnvironmentVars: map[string]string{"ENV": "B"}}
+	envs := mtx.migrationEnv(m, "do")
+	ok, err := evaluateCondition(`ENV == "B" && GMIG_MIGRATION_FILE == "020_two.yaml" && GMIG_SECTION == "do" && GMIG_LAST_APPLIED == "010_one.yaml" && GMIG_MIGRATIONS_DIR == "/here"`, envs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := ok, true; got != want {
+		t.Errorf("got [%v] want [%v]", got, want)
+	}
+}
+
+func TestHeaderCommentAsDescription(t *testing.T) {
+	data := []byte(`
+# add loadrunner service account
+#
+# file: 010_add_loadrunner_service_account.yaml
+
+do:
+- gcloud config list
+# comment for undo
+undo:
+- gcloud config list
+`)
+	if got, want := headerComment(data), "add loadrunner service account"; got != want {
+		t.Errorf("got [%v] want [%v]", got, want)
+	}
+}
+
+func TestMigrationToYAMLDescriptionRoundtrip(t *testing.T) {
+	m := Migration{
+		Filename:    "010_one.yaml",
+		Description: "one: two",
+		Owner:       "platform",
+		Ticket:      "OPS-1",
+		DoSection:   []string{"gcloud config list"},
+	}
+	data, err := m.ToYAML()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var back Migration
+	if err := yaml.Unmarshal(data, &back); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := back.Description, m.Description; got != want {
+		t.Errorf("got [%v] want [%v]", got, want)
+	}
+	if got, want := back.Owner, m.Owner; got != want {
+		t.Errorf("got [%v] want [%v]", got, want)
+	}
+	if got, want := back.Ticket, m.Ticket; got != want {
+		t.Errorf("got [%v] want [%v]", got, want)
+	}
+}
+
+func TestNewStatusEntry(t *testing.T) {
+	e := newStatusEntry(Migration{Filename: "010_one.yaml", Owner: "platform"}, skipping)
+	if got, want := e.Status, "skipping"; got != want {
+		t.Errorf("got [%v] want [%v]", got, want)
+	}
+	if got, want := e.Owner, "platform"; got != want {
+		t.Errorf("got [%v] want [%v]", got, want)
+	}
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Module holds parameterised sections that can be used by migrations.
+type Module struct {
+	// Parameters are the names of values that a migration must provide using "with".
+	Parameters      []string `yaml:"parameters"`
+	PrecheckSection []string `yaml:"precheck"`
+	DoSection       []string `yaml:"do"`
+	UndoSection     []string `yaml:"undo"`
+	ViewSection     []string `yaml:"view"`
+}
+
+// LoadModule reads and parses a module from a named file.
+func LoadModule(absFilename string) (m Module, err error) {
+	data, err := os.ReadFile(absFilename)
+	if err != nil {
+		return m, fmt.Errorf("%s reading module failed: %v", absFilename, err)
+	}
+	if err = yaml.UnmarshalStrict(data, &m); err != nil {
+		err = fmt.Errorf("%s parsing module failed: %v", absFilename, err)
+	}
+	return
+}
+
+// expandModule replaces the sections of a migration by those of the module it uses, if any.
+// Commands of the module are run before those of the migration itself ; for undo, after.
+// The module filename is relative to the folder of the migration.
+func expandModule(m Migration, migrationsPath string) (Migration, error) {
+	if len(m.Use) == 0 {
+		return m, nil
+	}
+	mod, err := LoadModule(filepath.Join(migrationsPath, m.Use))
+	if err != nil {
+		return m, err
+	}
+	for _, each := range mod.Parameters {
+		if _, ok := m.With[each]; !ok {
+			return m, fmt.Errorf("%s: missing parameter [%s] for module [%s]", m.Filename, each, m.Use)
+		}
+	}
+	m.PrecheckSection = append(expandParameters(mod.PrecheckSection, m.With), m.PrecheckSection...)
+	m.DoSection = append(expandParameters(mod.DoSection, m.With), m.DoSection...)
+	m.UndoSection = append(m.UndoSection, expandParameters(mod.UndoSection, m.With)...)
+	m.ViewSection = append(expandParameters(mod.ViewSection, m.With), m.ViewSection...)
+	return m, nil
+}
+
+var regexpParameter = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}|\$([A-Za-z_][A-Za-z0-9_]*)`)
+
+// expandParameters returns the commands with all $NAME and ${NAME} replaced by known parameter values.
+// Other variables are left untouched for the shell.
+func expandParameters(commands []string, params map[string]string) (expanded []string) {
+	for _, each := range commands {
+		expanded = append(expanded, regexpParameter.ReplaceAllStringFunc(each, func(v string) string {
+			sub := regexpParameter.FindStringSubmatch(v)
+			name := sub[1] + sub[2]
+			if value, ok := params[name]; ok {
+				return value
+			}
+			return v
+		}))
+	}
+	return
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestExpandParameters(t *testing.T) {
+	params := map[string]string{"NAME": "loadrunner"}
+	got := expandParameters([]string{"create $NAME ${NAME}-key $NAMESPACE $PROJECT"}, params)[0]
+	if want := "create loadrunner loadrunner-key $NAMESPACE $PROJECT"; got != want {
+		t.Errorf("got [%v] want [%v]", got, want)
+	}
+}
+
+func TestLoadMigrationUsingModule(t *testing.T) {
+	m, err := LoadMigration(filepath.Join("examples", "045_create_loadrunner_service_account.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := m.DoSection[0], `gcloud iam service-accounts create loadrunner --display-name "loadrunner"`; got != want {
+		t.Errorf("got [%v] want [%v]", got, want)
+	}
+	if got, want := len(m.UndoSection), 3; got != want {
+		t.Errorf("got [%v] want [%v]", got, want)
+	}
+}
+
+func TestLoadMigrationUsingModuleMissingParameter(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "module.yaml"), []byte("parameters: [NAME]\ndo:\n- echo $NAME\n"), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "010_use.yaml"), []byte("use: module.yaml\n"), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadMigration(filepath.Join(dir, "010_use.yaml")); err == nil {
+		t.Fatal("expected error")
+	}
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	namingIndex     = "index"
+	namingTimestamp = "timestamp"
+	namingHybrid    = "hybrid"
+
+	defaultIndexStep = 5
+)
+
+// regexpHybrid matches an index followed by a timestamp, e.g. 045_20060102t150405_
+var regexpHybrid = regexp.MustCompile("^[0-9]{3}_[0-9]{8}t[0-9]{6}_")
+
+// Naming holds how filenames of new migrations are made.
+type Naming struct {
+	// Strategy is one of index (default), timestamp or hybrid (an index followed by a timestamp).
+	Strategy string `json:"strategy,omitempty" yaml:"strategy,omitempty"`
+	// Step is added to the index of the last migration ; default is 5.
+	Step int `json:"step,omitempty" yaml:"step,omitempty"`
+}
+
+// Validate checks the strategy and step.
+func (n Naming) Validate() error {
+	switch n.Strategy {
+	case "", namingIndex, namingTimestamp, namingHybrid:
+	default:
+		return fmt.Errorf("unknown naming strategy [%s], must be one of index,timestamp,hybrid", n.Strategy)
+	}
+	if n.Step < 0 {
+		return fmt.Errorf("naming step [%d] must be positive", n.Step)
+	}
+	return nil
+}
+
+// newMigrationFilename returns the filename for a new migration that sorts after the existing ones.
+func newMigrationFilename(migrationsPath string, folders []string, naming Naming, desc string) (string, error) {
+	if err := naming.Validate(); err != nil {
+		return "", err
+	}
+	existing, err := collectMigrationFiles(migrationsPath, folders)
+	if err != nil {
+		return "", err
+	}
+	sanitized := strings.Replace(strings.ToLower(desc), " ", "_", -1)
+	timestamp := timeNow().Format("20060102t150405")
+	if naming.Strategy == namingTimestamp {
+		return checkSortsLast(existing, fmt.Sprintf("%s_%s.yaml", timestamp, sanitized))
+	}
+	step := naming.Step
+	if step == 0 {
+		step = defaultIndexStep
+	}
+	index := 10
+	if len(existing) > 0 {
+		lastFilename := migrationName(existing[len(existing)-1])
+		if regexpIndex.MatchString(lastFilename) {
+			i, err := strconv.Atoi(lastFilename[:3])
+			if err != nil {
+				return "", err
+			}
+			index = i + step
+		} else if regexpTimestamp.MatchString(lastFilename) {
+			// sorts after timestamps of this century
+			index = 300
+		}
+	}
+	if index > 999 {
+		return "", fmt.Errorf("index [%d] has more than 3 digits, use the timestamp naming strategy", index)
+	}
+	if naming.Strategy == namingHybrid {
+		return checkSortsLast(existing, fmt.Sprintf("%03d_%s_%s.yaml", index, timestamp, sanitized))
+	}
+	return fmt.Sprintf("%03d_%s.yaml", index, sanitized), nil
+}
+
+// checkSortsLast returns an error if the filename sorts before an existing migration.
+func checkSortsLast(existing []string, filename string) (string, error) {
+	if len(existing) > 0 && sortsBefore(filename, existing[len(existing)-1]) {
+		return "", fmt.Errorf("new migration [%s] would sort before [%s], use another naming strategy", filename, existing[len(existing)-1])
+	}
+	return filename, nil
+}
+
+// migrationPrefix returns the index, timestamp or both at the start of a filename ; empty if there is none.
+func migrationPrefix(filename string) string {
+	name := migrationName(filename)
+	switch {
+	case regexpHybrid.MatchString(name):
+		return name[:19]
+	case regexpIndex.MatchString(name):
+		return name[:3]
+	case regexpTimestamp.MatchString(name):
+		return name[:15]
+	}
+	return ""
+}
+
+// warnBranchCollisions warns about migrations on other git branches that have the same prefix as the new filename.
+// Nothing is reported if the migrations path is not in a git repository.
+func warnBranchCollisions(migrationsPath, filename string) {
+	prefix := migrationPrefix(filename)
+	if len(prefix) == 0 {
+		return
+	}
+	for _, each := range gitBranchCollisions(migrationsPath, prefix) {
+		printWarning(fmt.Sprintf("new migration [%s] has the same prefix as [%s] on branch [%s]", filename, each[1], each[0]))
+	}
+}
+
+// gitBranchCollisions returns pairs of branch and filename of migrations that have the prefix but are not in the migrations path.
+func gitBranchCollisions(migrationsPath, prefix string) (collisions [][2]string) {
+	out, err := runCommand(exec.Command("git", "-C", migrationsPath, "for-each-ref", "--format=%(refname:short)", "refs/heads", "refs/remotes"))
+	if err != nil {
+		// not a git repository or no git installed
+		return
+	}
+	refs := strings.Fields(string(out))
+	sort.Strings(refs)
+	for _, ref := range refs {
+		if strings.HasSuffix(ref, "/HEAD") {
+			continue
+		}
+		files, err := runCommand(exec.Command("git", "-C", migrationsPath, "ls-tree", "-r", "--name-only", ref, "."))
+		if err != nil {
+			continue
+		}
+		for _, each := range strings.Fields(string(files)) {
+			if !isMigrationFile(each) || migrationPrefix(each) != prefix {
+				continue
+			}
+			if checkExists(filepath.Join(migrationsPath, each)) == nil {
+				// also on this branch
+				continue
+			}
+			collisions = append(collisions, [2]string{ref, each})
+		}
+	}
+	return
+}
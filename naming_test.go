@@ -0,0 +1,94 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"log"
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNewMigrationFilenameStrategies(t *testing.T) {
+	timeNow = func() time.Time { return time.Date(2024, 3, 1, 12, 30, 45, 0, time.UTC) }
+	defer func() { timeNow = time.Now }()
+	dir := t.TempDir()
+	writeTestFiles(t, dir, "010_one.yaml", "iam/040_two.yaml")
+	for _, each := range []struct {
+		naming  Naming
+		folders []string
+		want    string
+	}{
+		{Naming{}, nil, "015_new_one.yaml"},
+		{Naming{Step: 10}, nil, "020_new_one.yaml"},
+		{Naming{}, []string{"."}, "045_new_one.yaml"},
+		{Naming{Strategy: namingTimestamp}, nil, "20240301t123045_new_one.yaml"},
+		{Naming{Strategy: namingHybrid}, nil, "015_20240301t123045_new_one.yaml"},
+	} {
+		got, err := newMigrationFilename(dir, each.folders, each.naming, "new one")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != each.want {
+			t.Errorf("got [%v] want [%v]", got, each.want)
+		}
+	}
+	if _, err := newMigrationFilename(dir, nil, Naming{Strategy: "random"}, "new one"); err == nil {
+		t.Error("expected unknown strategy error")
+	}
+}
+
+func TestNewMigrationFilenameTimestampBeforeIndex(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFiles(t, dir, "300_high.yaml")
+	if _, err := newMigrationFilename(dir, nil, Naming{Strategy: namingTimestamp}, "new one"); err == nil {
+		t.Error("expected sort error")
+	}
+}
+
+func TestGitBranchCollisions(t *testing.T) {
+	defer func(old func(*exec.Cmd) ([]byte, error)) { runCommand = old }(runCommand)
+	runCommand = func(cmd *exec.Cmd) ([]byte, error) {
+		if strings.Contains(strings.Join(cmd.Args, " "), "for-each-ref") {
+			return []byte("feature\norigin/HEAD\n"), nil
+		}
+		return []byte("015_on_feature.yaml\n020_other.yaml\nREADME.md\n"), nil
+	}
+	got := gitBranchCollisions(t.TempDir(), migrationPrefix("015_on_main.yaml"))
+	if len(got) != 1 {
+		t.Fatalf("got [%v] want one collision", got)
+	}
+	if got, want := got[0][1], "015_on_feature.yaml"; got != want {
+		t.Errorf("got [%v] want [%v]", got, want)
+	}
+}
+
+func TestGitBranchCollisionsOutsideRepository(t *testing.T) {
+	defer func(old func(*exec.Cmd) ([]byte, error)) { runCommand = old }(runCommand)
+	cc := &commandCapturer{output: []byte("fatal: not a git repository"), err: errors.New("exit status 128")}
+	runCommand = cc.runCommand
+	out := new(bytes.Buffer)
+	log.SetOutput(out)
+	defer log.SetOutput(os.Stderr)
+	if got := gitBranchCollisions(t.TempDir(), "015"); len(got) != 0 {
+		t.Errorf("got [%v] want no collisions", got)
+	}
+	if got := out.String(); len(got) != 0 {
+		t.Errorf("got [%v] want no output", got)
+	}
+}
+
+func TestMigrationPrefix(t *testing.T) {
+	for name, want := range map[string]string{
+		"iam/045_x.yaml":             "045",
+		"20240301t123045_x.yaml":     "20240301t123045",
+		"045_20240301t123045_x.yaml": "045_20240301t123045",
+		"create_x.yaml":              "",
+	} {
+		if got := migrationPrefix(name); got != want {
+			t.Errorf("got [%v] want [%v]", got, want)
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/urfave/cli"
+)
+
+// executeDo runs the do section of a migration and returns the outputs it has written
+// as KEY=value lines to the file referenced by $GMIG_OUTPUTS.
+func executeDo(m Migration, condition Condition, envs []string, verbose bool) (map[string]string, error) {
+	f, err := os.CreateTemp("", "gmig-outputs")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temporary outputs file:%v", err)
+	}
+	f.Close()
+	defer os.Remove(f.Name())
+	envs = append(envs, "GMIG_OUTPUTS="+f.Name())
+	if err := forEachRun(m, "do", envs, func(runEnvs []string) error {
+		return ExecuteAll(condition, m.DoSection, runEnvs, verbose)
+	}); err != nil {
+		return nil, err
+	}
+	outputs, err := readOutputs(f.Name())
+	if err != nil {
+		return nil, err
+	}
+	for _, each := range m.Outputs {
+		if _, ok := outputs[each]; !ok {
+			printWarning("declared output", each, "was not written by", m.Filename)
+		}
+	}
+	return outputs, nil
+}
+
+// readOutputs parses KEY=value lines, skipping empty lines and comments.
+func readOutputs(filename string) (map[string]string, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	outputs := map[string]string{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if len(line) == 0 || strings.HasPrefix(line, "#") {
+			continue
+		}
+		kv := strings.SplitN(line, "=", 2)
+		if len(kv) != 2 || len(strings.TrimSpace(kv[0])) == 0 {
+			return nil, fmt.Errorf("invalid output line, expected KEY=value [%s]", line)
+		}
+		outputs[strings.TrimSpace(kv[0])] = kv[1]
+	}
+	return outputs, scanner.Err()
+}
+
+// withoutOutputsOf returns a copy of all outputs except those captured from a migration.
+func withoutOutputsOf(outputs map[string]map[string]string, filename string) map[string]map[string]string {
+	kept := map[string]map[string]string{}
+	for k, v := range outputs {
+		if !sameMigration(k, filename) {
+			kept[k] = v
+		}
+	}
+	return kept
+}
+
+func cmdOutputs(c *cli.Context) error {
+	mtx, err := getMigrationContext(c)
+	if err != nil {
+		printError(err.Error())
+		return errAbort
+	}
+	filenames := []string{}
+	for each := range mtx.outputs {
+		filenames = append(filenames, each)
+	}
+	sort.Strings(filenames)
+	for _, each := range filenames {
+		log.Println(statusSeparator)
+		log.Println(pretty(each), "("+each+")")
+		keys := []string{}
+		for k := range mtx.outputs[each] {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			fmt.Printf("%s=%s\n", k, mtx.outputs[each][k])
+		}
+	}
+	if len(filenames) > 0 {
+		log.Println(statusSeparator)
+	}
+	return nil
+}
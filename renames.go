@@ -0,0 +1,91 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// renamesFilename is the name of the manifest, in the migrations path, that maps old migration filenames to new ones.
+const renamesFilename = "renames.yaml"
+
+// loadRenames returns the renames from the manifest in the migrations path, if present, merged with those of the configuration.
+func loadRenames(migrationsPath string, config Config) (map[string]string, error) {
+	renames := map[string]string{}
+	data, err := os.ReadFile(filepath.Join(migrationsPath, renamesFilename))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if err == nil {
+		if err := yaml.Unmarshal(data, &renames); err != nil {
+			return nil, fmt.Errorf("%s parsing failed: %v", renamesFilename, err)
+		}
+	}
+	// configuration overrides
+	for k, v := range config.Renames {
+		renames[k] = v
+	}
+	return renames, nil
+}
+
+// resolveRename returns the current filename of a migration that may have been renamed one or more times.
+func resolveRename(renames map[string]string, filename string) (string, error) {
+	visited := map[string]bool{migrationName(filename): true}
+	current := filename
+	for {
+		next, ok := lookupRename(renames, current)
+		if !ok {
+			return current, nil
+		}
+		if sameMigration(next, current) {
+			// moved to another folder
+			return next, nil
+		}
+		if visited[migrationName(next)] {
+			return "", fmt.Errorf("cyclic renames of migration [%s]", filename)
+		}
+		visited[migrationName(next)] = true
+		current = next
+	}
+}
+
+// lookupRename returns the new filename if the migration was renamed ; old names can be given with or without a folder.
+func lookupRename(renames map[string]string, filename string) (string, bool) {
+	if next, ok := renames[filename]; ok {
+		return next, true
+	}
+	for old, next := range renames {
+		if sameMigration(old, filename) {
+			return next, true
+		}
+	}
+	return "", false
+}
+
+// renameOutputs returns the outputs with those of renamed migrations stored under their new filename.
+func renameOutputs(outputs map[string]map[string]string, renames map[string]string) (map[string]map[string]string, error) {
+	renamed := map[string]map[string]string{}
+	for k, v := range outputs {
+		current, err := resolveRename(renames, k)
+		if err != nil {
+			return nil, err
+		}
+		renamed[current] = v
+	}
+	return renamed, nil
+}
+
+// renameSkipped returns the skipped probes with those of renamed migrations stored under their new filename.
+func renameSkipped(skipped []string, renames map[string]string) (renamed []string, err error) {
+	for _, each := range skipped {
+		nameAndItem := strings.SplitN(each, "|", 2)
+		if nameAndItem[0], err = resolveRename(renames, nameAndItem[0]); err != nil {
+			return nil, err
+		}
+		renamed = append(renamed, strings.Join(nameAndItem, "|"))
+	}
+	return
+}
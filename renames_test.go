@@ -0,0 +1,64 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestResolveRename(t *testing.T) {
+	renames := map[string]string{
+		"010_one.yaml":        "010_first.yaml",
+		"010_first.yaml":      "iam/010_first.yaml",
+		"020_two.yaml":        "020_second.yaml",
+		"iam/030_loop.yaml":   "030_loop_again.yaml",
+		"030_loop_again.yaml": "030_loop.yaml",
+	}
+	for _, each := range []struct {
+		old, want string
+	}{
+		{"010_one.yaml", "iam/010_first.yaml"},
+		{"network/020_two.yaml", "020_second.yaml"},
+		{"040_four.yaml", "040_four.yaml"},
+	} {
+		got, err := resolveRename(renames, each.old)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != each.want {
+			t.Errorf("got [%v] want [%v]", got, each.want)
+		}
+	}
+	if _, err := resolveRename(renames, "030_loop.yaml"); err == nil {
+		t.Error("expected cyclic renames error")
+	}
+}
+
+func TestLoadRenamesConfigOverridesManifest(t *testing.T) {
+	dir := t.TempDir()
+	manifest := "010_one.yaml: 010_first.yaml\n020_two.yaml: 020_second.yaml\n"
+	if err := os.WriteFile(filepath.Join(dir, renamesFilename), []byte(manifest), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	renames, err := loadRenames(dir, Config{Renames: map[string]string{"020_two.yaml": "020_other.yaml"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := renames["010_one.yaml"], "010_first.yaml"; got != want {
+		t.Errorf("got [%v] want [%v]", got, want)
+	}
+	if got, want := renames["020_two.yaml"], "020_other.yaml"; got != want {
+		t.Errorf("got [%v] want [%v]", got, want)
+	}
+}
+
+func TestRenameOutputs(t *testing.T) {
+	outputs := map[string]map[string]string{"010_one.yaml": {"IP": "1.2.3.4"}}
+	renamed, err := renameOutputs(outputs, map[string]string{"010_one.yaml": "010_first.yaml"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := renamed["010_first.yaml"]["IP"], "1.2.3.4"; got != want {
+		t.Errorf("got [%v] want [%v]", got, want)
+	}
+}
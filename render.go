@@ -0,0 +1,90 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strings"
+	"text/template"
+)
+
+// templateData is available to migration sections that are rendered as Go templates.
+type templateData struct {
+	Project string
+	Region  string
+	Zone    string
+	// Env holds the custom environment values of the configuration and the migration.
+	Env map[string]string
+	// Outputs holds the values captured from applied migrations.
+	Outputs map[string]string
+}
+
+// render returns the migration with its sections rendered as Go templates
+// if either the migration or the configuration has template enabled.
+func (m migrationContext) render(mig Migration) (Migration, error) {
+	if !mig.Template && !m.config().Template {
+		return mig, nil
+	}
+	cfg := m.config()
+	data := templateData{
+		Project: cfg.Project,
+		Region:  cfg.Region,
+		Zone:    cfg.Zone,
+		Env:     map[string]string{},
+		Outputs: map[string]string{},
+	}
+	for k, v := range cfg.EnvironmentVars {
+		data.Env[k] = v
+	}
+	for k, v := range mig.EnvironmentVars {
+		data.Env[k] = v
+	}
+	for _, each := range (State{Outputs: m.outputs}).outputEnv() {
+		kv := strings.SplitN(each, "=", 2)
+		data.Outputs[kv[0]] = kv[1]
+	}
+	var err error
+	if mig.IfExpression, err = renderText(mig.Filename+"#if", mig.IfExpression, data); err != nil {
+		return mig, err
+	}
+	for _, each := range []*[]string{&mig.IfCommand, &mig.PrecheckSection, &mig.DoSection, &mig.UndoSection, &mig.ViewSection} {
+		if *each, err = renderSection(mig.Filename, *each, data); err != nil {
+			return mig, err
+		}
+	}
+	return mig, nil
+}
+
+// renderSection renders all commands as one template such that conditionals and ranges
+// can span multiple commands. Each non-empty line of the result is a command.
+func renderSection(name string, commands []string, data templateData) (rendered []string, err error) {
+	if len(commands) == 0 {
+		return commands, nil
+	}
+	text, err := renderText(name, strings.Join(commands, "\n"), data)
+	if err != nil {
+		return nil, err
+	}
+	for _, each := range strings.Split(text, "\n") {
+		if len(strings.TrimSpace(each)) > 0 {
+			rendered = append(rendered, each)
+		}
+	}
+	return
+}
+
+func renderText(name, text string, data templateData) (string, error) {
+	if len(text) == 0 {
+		return text, nil
+	}
+	funcs := template.FuncMap{"env": os.Getenv, "split": strings.Split}
+	tmpl, err := template.New(name).Funcs(funcs).Parse(text)
+	if err != nil {
+		return "", fmt.Errorf("%s template parsing failed: %v", name, err)
+	}
+	output := new(bytes.Buffer)
+	if err := tmpl.Execute(output, data); err != nil {
+		return "", fmt.Errorf("%s template execution failed: %v", name, err)
+	}
+	return output.String(), nil
+}
@@ -0,0 +1,50 @@
+package main
+
+import "testing"
+
+func TestRenderMigration(t *testing.T) {
+	mtx := migrationContext{
+		stateProvider: NewFileStateProvider(Config{Project: "demo", EnvironmentVars: map[string]string{"ENV": "prod"}}),
+		outputs:       map[string]map[string]string{"010_one.yaml": {"IP": "1.2.3.4"}},
+	}
+	m := Migration{
+		Filename:     "020_two.yaml",
+		Template:     true,
+		IfExpression: `PROJECT == "{{.Project}}"`,
+		IfCommand:    []string{`gcloud services list --project {{.Project}}`},
+		DoSection: []string{
+			`{{range $i, $r := split "a,b" ","}}`,
+			`echo {{$r}}`,
+			`{{end}}`,
+			`{{if eq .Env.ENV "prod"}}echo {{.Outputs.IP}}{{end}}`,
+		},
+	}
+	r, err := mtx.render(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := r.IfExpression, `PROJECT == "demo"`; got != want {
+		t.Errorf("got [%v] want [%v]", got, want)
+	}
+	if got, want := r.IfCommand[0], "gcloud services list --project demo"; got != want {
+		t.Errorf("got [%v] want [%v]", got, want)
+	}
+	if got, want := len(r.DoSection), 3; got != want {
+		t.Fatalf("got [%v] want [%v] %v", got, want, r.DoSection)
+	}
+	if got, want := r.DoSection[2], "echo 1.2.3.4"; got != want {
+		t.Errorf("got [%v] want [%v]", got, want)
+	}
+}
+
+func TestRenderMigrationNotEnabled(t *testing.T) {
+	mtx := migrationContext{stateProvider: NewFileStateProvider(Config{Project: "demo"})}
+	m := Migration{DoSection: []string{"echo {{.Project}}"}}
+	r, err := mtx.render(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := r.DoSection[0], "echo {{.Project}}"; got != want {
+		t.Errorf("got [%v] want [%v]", got, want)
+	}
+}
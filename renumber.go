@@ -0,0 +1,234 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/urfave/cli"
+	"gopkg.in/yaml.v2"
+)
+
+// renumbering is the new filename of a migration, both relative to the migrations path.
+type renumbering struct {
+	From, To string
+}
+
+// renumberPlan returns the new filenames of all migrations such that they have an index with the step in between,
+// in the same order and folder. Migrations of which the filename does not change are left out.
+// Numbering starts after the highest index of the archived migrations such that all migrations keep sorting after them.
+func renumberPlan(filenames, archived []string, step int) ([]renumbering, error) {
+	if step <= 0 {
+		return nil, fmt.Errorf("step [%d] must be positive", step)
+	}
+	highest := 0
+	for _, each := range archived {
+		if name := migrationName(each); regexpIndex.MatchString(name) {
+			if i, err := strconv.Atoi(name[:3]); err == nil && i > highest {
+				highest = i
+			}
+		}
+	}
+	first := (highest/step + 1) * step
+	if last := first + step*(len(filenames)-1); last > 999 {
+		return nil, fmt.Errorf("%d migrations with step %d need an index [%d] of more than 3 digits, use a smaller step", len(filenames), step, last)
+	}
+	plan := []renumbering{}
+	for i, each := range filenames {
+		name := migrationName(each)
+		rest := strings.TrimPrefix(name, migrationPrefix(name))
+		rest = strings.TrimPrefix(rest, "_")
+		to := path.Join(path.Dir(each), fmt.Sprintf("%03d_%s", first+i*step, rest))
+		if i == 0 && len(archived) > 0 && sortsBefore(to, archived[len(archived)-1]) {
+			return nil, fmt.Errorf("renumbered migration [%s] would sort before archived migration [%s], which targets have applied", to, archived[len(archived)-1])
+		}
+		if to != each {
+			plan = append(plan, renumbering{From: each, To: to})
+		}
+	}
+	return plan, nil
+}
+
+// checkRenumbering returns an error if a new filename of the plan is, or was, the filename of another migration.
+// A target that has the filename in its state could then not tell which migration it has applied.
+func checkRenumbering(plan []renumbering, filenames []string, renames map[string]string) error {
+	for _, each := range plan {
+		for _, other := range filenames {
+			if sameMigration(other, each.To) && !sameMigration(other, each.From) {
+				return fmt.Errorf("new filename [%s] of [%s] is the filename of [%s], change the description of one of them first", each.To, each.From, other)
+			}
+		}
+		for old, next := range renames {
+			if !sameMigration(old, each.To) {
+				continue
+			}
+			// a migration can get an earlier filename back
+			if sameMigration(renamedBy(plan, next), each.To) {
+				continue
+			}
+			return fmt.Errorf("new filename [%s] of [%s] is the earlier filename of [%s], see %s", each.To, each.From, next, renamesFilename)
+		}
+	}
+	return nil
+}
+
+// renamedBy returns the new filename of a migration in the plan ; the filename itself if it is not renamed.
+func renamedBy(plan []renumbering, filename string) string {
+	for _, each := range plan {
+		if sameMigration(each.From, filename) {
+			return each.To
+		}
+	}
+	return filename
+}
+
+// applyRenumbering renames the migration files, updates the requires of all migrations
+// and adds the renames to the manifest in the migrations path such that the state of each target is updated.
+func applyRenumbering(migrationsPath string, filenames []string, plan []renumbering) error {
+	// two steps, a new filename can be the old filename of another migration
+	for _, each := range plan {
+		if err := os.Rename(filepath.Join(migrationsPath, each.From), filepath.Join(migrationsPath, each.To+".renumbering")); err != nil {
+			return err
+		}
+	}
+	for _, each := range plan {
+		if err := os.Rename(filepath.Join(migrationsPath, each.To+".renumbering"), filepath.Join(migrationsPath, each.To)); err != nil {
+			return err
+		}
+	}
+	renamed := map[string]string{}
+	for _, each := range plan {
+		renamed[each.From] = each.To
+	}
+	current := []string{}
+	for _, each := range filenames {
+		if to, ok := renamed[each]; ok {
+			each = to
+		}
+		current = append(current, each)
+	}
+	if err := rewriteReferences(migrationsPath, current, plan); err != nil {
+		return err
+	}
+	return addRenames(migrationsPath, plan)
+}
+
+// rewriteReferences replaces the old filenames of the plan by the new ones in the migration files, such as in their requires.
+func rewriteReferences(migrationsPath string, filenames []string, plan []renumbering) error {
+	// requires can refer to a migration by its name only
+	pairs := []string{}
+	for _, each := range plan {
+		pairs = append(pairs, each.From, each.To, migrationName(each.From), migrationName(each.To))
+	}
+	replacer := strings.NewReplacer(pairs...)
+	for _, each := range filenames {
+		full := filepath.Join(migrationsPath, each)
+		data, err := os.ReadFile(full)
+		if err != nil {
+			return err
+		}
+		if replaced := replacer.Replace(string(data)); replaced != string(data) {
+			if err := os.WriteFile(full, []byte(replaced), os.FileMode(0644)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// addRenames writes the renames to the manifest in the migrations path, keeping those already there.
+// Earlier renames point to the new filename directly, such that no rename needs to be followed by another.
+func addRenames(migrationsPath string, plan []renumbering) error {
+	earlier, err := loadRenames(migrationsPath, Config{})
+	if err != nil {
+		return err
+	}
+	renames := map[string]string{}
+	for old, next := range earlier {
+		next = renamedBy(plan, next)
+		// a migration can get an earlier filename back
+		if !sameMigration(old, next) {
+			renames[old] = next
+		}
+	}
+	for _, each := range plan {
+		renames[each.From] = each.To
+	}
+	keys := []string{}
+	for k := range renames {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	out := new(strings.Builder)
+	fmt.Fprintln(out, "# old filename of a migration: new filename ; written by gmig renumber")
+	for _, k := range keys {
+		line, _ := yaml.Marshal(map[string]string{k: renames[k]})
+		out.Write(line)
+	}
+	return os.WriteFile(filepath.Join(migrationsPath, renamesFilename), []byte(out.String()), os.FileMode(0644))
+}
+
+func cmdRenumber(c *cli.Context) error {
+	migrationsPath, cfg, err := newMigrationSettings(c)
+	if err != nil {
+		printError(err.Error())
+		return errAbort
+	}
+	filenames, err := collectMigrationFiles(migrationsPath, cfg.Migrations)
+	if err != nil {
+		printError(err.Error())
+		return errAbort
+	}
+	archived, err := archivedMigrationFiles(migrationsPath)
+	if err != nil {
+		printError(err.Error())
+		return errAbort
+	}
+	plan, err := renumberPlan(filenames, archived, c.Int("step"))
+	if err != nil {
+		printError(err.Error())
+		return errAbort
+	}
+	renames, err := loadRenames(migrationsPath, cfg)
+	if err != nil {
+		printError(err.Error())
+		return errAbort
+	}
+	if err := checkRenumbering(plan, append(append([]string{}, filenames...), archived...), renames); err != nil {
+		printError(err.Error())
+		return errAbort
+	}
+	if len(plan) == 0 {
+		log.Println("all migrations are numbered already")
+		return nil
+	}
+	width := 0
+	for _, each := range plan {
+		if len(each.From) > width {
+			width = len(each.From)
+		}
+	}
+	for _, each := range plan {
+		fmt.Printf("%-*s -> %s\n", width, each.From, each.To)
+	}
+	if !c.Bool("apply") {
+		log.Printf("dry run, use --apply to rename %d migration(s)\n", len(plan))
+		return nil
+	}
+	if !c.GlobalBool("q") {
+		if !promptForYes(fmt.Sprintf("Are you sure to rename %d migration(s) in [%s] (y/N)? ", len(plan), migrationsPath)) {
+			return errAbort
+		}
+	}
+	if err := applyRenumbering(migrationsPath, filenames, plan); err != nil {
+		printError(err.Error())
+		return errAbort
+	}
+	log.Printf("renamed %d migration(s) and added them to %s\n", len(plan), renamesFilename)
+	return nil
+}
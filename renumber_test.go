@@ -0,0 +1,134 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRenumberPlan(t *testing.T) {
+	plan, err := renumberPlan([]string{
+		"010_one.yaml",
+		"iam/011_two.yaml",
+		"045_20240102t150405_three.yaml",
+		"20240103t150405_four.md",
+		"050_five.yaml"}, nil, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := []string{}
+	for _, each := range plan {
+		got = append(got, each.From+">"+each.To)
+	}
+	want := "iam/011_two.yaml>iam/020_two.yaml,045_20240102t150405_three.yaml>030_three.yaml,20240103t150405_four.md>040_four.md"
+	if got := strings.Join(got, ","); got != want {
+		t.Errorf("got [%v] want [%v]", got, want)
+	}
+}
+
+func TestRenumberPlanTooMany(t *testing.T) {
+	filenames := []string{}
+	for i := 1; i <= 101; i++ {
+		filenames = append(filenames, fmt.Sprintf("%03d_m.yaml", i))
+	}
+	if _, err := renumberPlan(filenames, nil, 10); err == nil {
+		t.Fatal("error expected")
+	}
+	if _, err := renumberPlan(filenames, nil, 5); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRenumberPlanAfterArchived(t *testing.T) {
+	plan, err := renumberPlan([]string{"300_three.yaml", "400_four.yaml"}, []string{"archive/100_one.yaml", "archive/200_two.yaml"}, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := []string{}
+	for _, each := range plan {
+		got = append(got, each.From+">"+each.To)
+	}
+	if got, want := strings.Join(got, ","), "300_three.yaml>210_three.yaml,400_four.yaml>220_four.yaml"; got != want {
+		t.Errorf("got [%v] want [%v]", got, want)
+	}
+	if _, err := renumberPlan([]string{"300_three.yaml"}, []string{"archive/20240102t150405_one.yaml"}, 10); err == nil {
+		t.Error("error expected")
+	}
+}
+
+func TestCheckRenumbering(t *testing.T) {
+	filenames := []string{"005_setup.yaml", "010_fix.yaml", "020_fix.yaml"}
+	plan, err := renumberPlan(filenames, nil, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := checkRenumbering(plan, filenames, map[string]string{}); err == nil {
+		t.Error("error expected")
+	}
+	filenames = []string{"015_one.yaml", "030_three.yaml"}
+	plan, _ = renumberPlan(filenames, nil, 10)
+	// 020_three.yaml was renamed to 030_three.yaml before
+	if err := checkRenumbering(plan, filenames, map[string]string{"020_three.yaml": "030_three.yaml"}); err != nil {
+		t.Error(err)
+	}
+	// 010_one.yaml was the filename of another migration
+	if err := checkRenumbering(plan, filenames, map[string]string{"010_one.yaml": "005_other.yaml"}); err == nil {
+		t.Error("error expected")
+	}
+}
+
+func TestApplyRenumbering(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFiles(t, dir, "010_one.yaml", "020_two.yaml")
+	if err := os.WriteFile(filepath.Join(dir, "030_three.yaml"), []byte("requires:\n- 020_two.yaml\ndo:\n- echo three"), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, renamesFilename), []byte("005_two.yaml: 020_two.yaml\n"), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	filenames, err := collectMigrationFiles(dir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	plan, err := renumberPlan(filenames, nil, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := applyRenumbering(dir, filenames, plan); err != nil {
+		t.Fatal(err)
+	}
+	after, _ := collectMigrationFiles(dir, nil)
+	if got, want := strings.Join(after, ","), "005_one.yaml,010_two.yaml,015_three.yaml"; got != want {
+		t.Errorf("got [%v] want [%v]", got, want)
+	}
+	m, err := LoadMigration(filepath.Join(dir, "015_three.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := strings.Join(m.Requires, ","), "010_two.yaml"; got != want {
+		t.Errorf("got [%v] want [%v]", got, want)
+	}
+	renames, err := loadRenames(dir, Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for old, want := range map[string]string{
+		"005_two.yaml":   "010_two.yaml",
+		"010_one.yaml":   "005_one.yaml",
+		"020_two.yaml":   "010_two.yaml",
+		"030_three.yaml": "015_three.yaml",
+	} {
+		got, err := resolveRename(renames, old)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Errorf("got [%v] want [%v]", got, want)
+		}
+	}
+	if _, ok := renames["010_two.yaml"]; ok {
+		t.Errorf("rename of current filename must be removed")
+	}
+}
@@ -0,0 +1,304 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/urfave/cli"
+	"gopkg.in/yaml.v2"
+)
+
+// defaultArchiveFolder is the folder, relative to the migrations path, with migrations that are no longer listed.
+const defaultArchiveFolder = "archive"
+
+// squashedCommand is a line of the do section of a squashed migration.
+type squashedCommand struct {
+	filename, line string
+	// created is set if the command creates a resource
+	created *resourceCommand
+	// cancelled is true if a later command deletes the created resource
+	cancelled bool
+}
+
+// squashMigrations returns a baseline migration with the do sections of all migrations, in order,
+// leaving out resources that are created by one migration and deleted by a later one.
+// Other commands that use such a resource, e.g. to bind a role to it, are left out too and kept as a comment.
+// Its undo section has those of all migrations, in reverse order, without the commands for the left out resources.
+func squashMigrations(rules []UndoRule, list []Migration) (Migration, error) {
+	baseline := Migration{EnvironmentVars: EnvironmentValues{}}
+	for _, each := range list {
+		if reason := notSquashable(each); len(reason) > 0 {
+			return baseline, fmt.Errorf("migration [%s] cannot be combined because it has %s, use --export instead", each.Filename, reason)
+		}
+		for k, v := range each.EnvironmentVars {
+			if other, ok := baseline.EnvironmentVars[k]; ok && other != v {
+				return baseline, fmt.Errorf("migration [%s] sets env [%s] to [%s] but an earlier migration to [%s]", each.Filename, k, v, other)
+			}
+			baseline.EnvironmentVars[k] = v
+		}
+		baseline.Outputs = append(baseline.Outputs, each.Outputs...)
+	}
+	commands := []*squashedCommand{}
+	cancelled := []resourceCommand{}
+	for _, each := range list {
+		for _, line := range each.DoSection {
+			cmd := &squashedCommand{filename: each.Filename, line: line}
+			if single := shellCommands([]string{line}); len(single) == 1 {
+				if _, remove, ok := matchUndoRule(rules, single[0], false); ok {
+					if created := lastCreated(rules, commands, remove); created != nil {
+						created.cancelled = true
+						cancelled = append(cancelled, *created.created)
+						continue
+					}
+				}
+				if _, create, ok := matchUndoRule(rules, single[0], true); ok {
+					cmd.created = &create
+				}
+			}
+			commands = append(commands, cmd)
+		}
+	}
+	removed := removedNames(commands, cancelled)
+	lastFilename := ""
+	for _, each := range commands {
+		if each.cancelled {
+			continue
+		}
+		if each.filename != lastFilename {
+			baseline.DoSection = append(baseline.DoSection, "# "+each.filename)
+			lastFilename = each.filename
+		}
+		if name, ok := mentionsAny(each.line, removed); ok {
+			baseline.DoSection = append(baseline.DoSection, fmt.Sprintf("# left out, uses removed %s: %s", name, each.line))
+			continue
+		}
+		baseline.DoSection = append(baseline.DoSection, each.line)
+	}
+	for i := len(list) - 1; i >= 0; i-- {
+		undo := []string{}
+		for _, line := range list[i].UndoSection {
+			// this also leaves out the undo of a migration that deleted the resource, which creates it again
+			if _, ok := mentionsAny(line, removed); ok {
+				continue
+			}
+			undo = append(undo, line)
+		}
+		if len(undo) > 0 {
+			baseline.UndoSection = append(append(baseline.UndoSection, "# "+list[i].Filename), undo...)
+		}
+	}
+	_, baseline.ViewSection = proposeUndoAndView(rules, baseline.DoSection)
+	return baseline, nil
+}
+
+// notSquashable returns why the commands of a migration cannot be combined with others ; empty if they can.
+func notSquashable(m Migration) string {
+	switch {
+	case len(m.IfExpression) > 0 || len(m.IfCommand) > 0:
+		return "a condition"
+	case len(m.Foreach.Items) > 0 || len(m.Foreach.Variable) > 0:
+		return "a foreach"
+	case len(m.Targets) > 0:
+		return "targets"
+	case m.Template:
+		return "template sections"
+	}
+	return ""
+}
+
+// lastCreated returns the latest command, not cancelled, that creates the resource that is removed ; nil if there is none.
+func lastCreated(rules []UndoRule, commands []*squashedCommand, remove resourceCommand) *squashedCommand {
+	for i := len(commands) - 1; i >= 0; i-- {
+		each := commands[i]
+		if each.created != nil && !each.cancelled && isInverseOf(rules, *each.created, remove) {
+			return each
+		}
+	}
+	return nil
+}
+
+// removedNames returns the names of the resources that are created and deleted by the squashed migrations
+// and are not created again by a command that is kept.
+func removedNames(commands []*squashedCommand, cancelled []resourceCommand) (names []string) {
+	for _, each := range cancelled {
+		recreated := false
+		for _, other := range commands {
+			if other.created != nil && !other.cancelled && sameResource(other.created.Resource, each.Resource) {
+				recreated = true
+				break
+			}
+		}
+		if !recreated {
+			name, _ := splitResource(each.Resource)
+			names = append(names, name)
+		}
+	}
+	return
+}
+
+// mentionsAny returns the first of the resource names that is used by a command line.
+// A word mentions a name if it is the name, an email that starts with it or a path that ends with it,
+// also as the value of a flag or a member such as serviceAccount:name@project.iam.gserviceaccount.com.
+func mentionsAny(line string, names []string) (string, bool) {
+	for _, word := range splitShellWords(line) {
+		parts := strings.FieldsFunc(word, func(r rune) bool { return r == '=' || r == ':' || r == ',' })
+		for _, part := range parts {
+			for _, name := range names {
+				if part == name || strings.HasPrefix(part, name+"@") || strings.HasSuffix(part, "/"+name) {
+					return name, true
+				}
+			}
+		}
+	}
+	return "", false
+}
+
+// exportedBaseline returns a baseline migration with the current IAM policies of the project and its buckets.
+func exportedBaseline(cfg Config) (Migration, error) {
+	baseline := Migration{}
+	for _, export := range []func(Config) ([]byte, error){projectsIAMPolicyMigration, storageIAMPolicyMigration} {
+		content, err := export(cfg)
+		if err != nil {
+			return baseline, err
+		}
+		var exported Migration
+		if err := yaml.Unmarshal(content, &exported); err != nil {
+			return baseline, err
+		}
+		baseline.DoSection = append(baseline.DoSection, exported.DoSection...)
+		baseline.UndoSection = append(baseline.UndoSection, exported.UndoSection...)
+	}
+	return baseline, nil
+}
+
+// baselineFilename returns the filename of the baseline that replaces the migrations until the last one.
+// It has the same prefix and folder such that it takes the same place in the order of migrations.
+func baselineFilename(last string) (string, error) {
+	prefix := migrationPrefix(last)
+	if len(prefix) == 0 {
+		return "", fmt.Errorf("migration [%s] has neither an index nor a timestamp prefix", last)
+	}
+	return path.Join(path.Dir(last), prefix+"_baseline.yaml"), nil
+}
+
+// checkNotInSquashed returns an error if the target has applied some but not all migrations that a pending baseline replaces.
+// Applying the baseline would run again the commands of the migrations that the target has applied.
+func checkNotInSquashed(lastApplied string, pending []Migration) error {
+	if len(lastApplied) == 0 {
+		return nil
+	}
+	for _, each := range pending {
+		for _, other := range each.Squashed {
+			if sameMigration(lastApplied, other) {
+				return fmt.Errorf("last applied [%s] is squashed into [%s], use force do for each of the remaining squashed migrations in the %s folder and then force state [%s]",
+					lastApplied, each.Filename, defaultArchiveFolder, each.Filename)
+			}
+		}
+	}
+	return nil
+}
+
+// applySquash writes the baseline, moves the migrations it has squashed into the archive folder
+// and records the rename of the last one such that targets that have applied it, have applied the baseline.
+func applySquash(migrationsPath string, folders []string, baseline Migration) error {
+	content, err := baseline.ToYAML()
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(migrationsPath, baseline.Filename), content, os.FileMode(0644)); err != nil {
+		return err
+	}
+	if err := archiveMigrations(migrationsPath, baseline.Squashed); err != nil {
+		return err
+	}
+	plan := []renumbering{}
+	for _, each := range baseline.Squashed {
+		plan = append(plan, renumbering{From: each, To: baseline.Filename})
+	}
+	all, err := collectMigrationFiles(migrationsPath, folders)
+	if err != nil {
+		return err
+	}
+	remaining := []string{}
+	for _, each := range all {
+		if each != baseline.Filename {
+			remaining = append(remaining, each)
+		}
+	}
+	// requires of squashed migrations are met by the baseline
+	if err := rewriteReferences(migrationsPath, remaining, plan); err != nil {
+		return err
+	}
+	return addRenames(migrationsPath, plan[len(plan)-1:])
+}
+
+func cmdSquash(c *cli.Context) error {
+	mtx, err := getMigrationContext(c)
+	if err != nil {
+		printError(err.Error())
+		return errAbort
+	}
+	until := c.String("until")
+	if len(until) == 0 {
+		printError("missing --until with the filename of the last migration to squash")
+		return errAbort
+	}
+	if until, err = mtx.migrationFile(until); err != nil {
+		printError(err.Error())
+		return errAbort
+	}
+	if len(mtx.lastApplied) == 0 || sortsBefore(mtx.lastApplied, until) {
+		printError(fmt.Sprintf("target [%s] has not applied [%s], last applied is [%s]", mtx.target(), until, mtx.lastApplied))
+		return errAbort
+	}
+	list, err := LoadMigrationsFromFoldersBetweenAnd(mtx.migrationsPath, mtx.config().Migrations, "", until)
+	if err != nil {
+		printError(err.Error())
+		return errAbort
+	}
+	var baseline Migration
+	if c.Bool("export") {
+		baseline, err = exportedBaseline(mtx.config())
+	} else {
+		rules := append(append([]UndoRule{}, undoRules...), mtx.config().UndoRules...)
+		baseline, err = squashMigrations(rules, list)
+	}
+	if err != nil {
+		printError(err.Error())
+		return errAbort
+	}
+	if baseline.Filename, err = baselineFilename(until); err != nil {
+		printError(err.Error())
+		return errAbort
+	}
+	baseline.Description = fmt.Sprintf("baseline of %d migrations until %s", len(list), until)
+	for _, each := range list {
+		baseline.Squashed = append(baseline.Squashed, each.Filename)
+		fmt.Printf("%s -> %s\n", each.Filename, path.Join(defaultArchiveFolder, each.Filename))
+	}
+	if !c.Bool("apply") {
+		content, err := baseline.ToYAML()
+		if err != nil {
+			printError(err.Error())
+			return errAbort
+		}
+		fmt.Println(string(content))
+		log.Printf("dry run, use --apply to write [%s] and archive %d migration(s)\n", baseline.Filename, len(list))
+		return nil
+	}
+	if !c.GlobalBool("q") {
+		if !promptForYes(fmt.Sprintf("Are you sure to replace %d migration(s) by [%s] (y/N)? ", len(list), baseline.Filename)) {
+			return errAbort
+		}
+	}
+	if err := applySquash(mtx.migrationsPath, mtx.config().Migrations, baseline); err != nil {
+		printError(err.Error())
+		return errAbort
+	}
+	log.Printf("wrote [%s], archived %d migration(s) and added [%s -> %s] to %s\n", baseline.Filename, len(list), until, baseline.Filename, renamesFilename)
+	return nil
+}
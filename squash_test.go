@@ -0,0 +1,157 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSquashMigrations(t *testing.T) {
+	list := []Migration{
+		{
+			Filename:        "010_one.yaml",
+			EnvironmentVars: EnvironmentValues{"SA": "loader"},
+			DoSection:       []string{"gcloud iam service-accounts create loader", "gcloud iam service-accounts create temp"},
+			UndoSection:     []string{"gcloud iam service-accounts delete temp@$PROJECT.iam.gserviceaccount.com", "gcloud iam service-accounts delete loader@$PROJECT.iam.gserviceaccount.com"},
+		},
+		{
+			Filename:    "020_two.yaml",
+			Outputs:     []string{"BUCKET"},
+			DoSection:   []string{"gcloud iam service-accounts delete temp@$PROJECT.iam.gserviceaccount.com --quiet", "echo BUCKET=b >> $GMIG_OUTPUTS"},
+			UndoSection: []string{"gcloud iam service-accounts create temp"},
+		},
+	}
+	baseline, err := squashMigrations(undoRules, list)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := strings.Join(baseline.DoSection, ","), "# 010_one.yaml,gcloud iam service-accounts create loader,# 020_two.yaml,echo BUCKET=b >> $GMIG_OUTPUTS"; got != want {
+		t.Errorf("got [%v] want [%v]", got, want)
+	}
+	if got, want := strings.Join(baseline.UndoSection, ","), "# 010_one.yaml,gcloud iam service-accounts delete loader@$PROJECT.iam.gserviceaccount.com"; got != want {
+		t.Errorf("got [%v] want [%v]", got, want)
+	}
+	if got, want := baseline.EnvironmentVars["SA"], "loader"; got != want {
+		t.Errorf("got [%v] want [%v]", got, want)
+	}
+	if got, want := strings.Join(baseline.Outputs, ","), "BUCKET"; got != want {
+		t.Errorf("got [%v] want [%v]", got, want)
+	}
+}
+
+func TestSquashMigrationsUsingRemovedResource(t *testing.T) {
+	list := []Migration{
+		{
+			Filename: "010_one.yaml",
+			DoSection: []string{
+				"gcloud iam service-accounts create temp",
+				"gcloud projects add-iam-policy-binding $PROJECT --member serviceAccount:temp@$PROJECT.iam.gserviceaccount.com --role roles/viewer",
+				"gcloud iam service-accounts create loader"},
+			UndoSection: []string{
+				"gcloud iam service-accounts delete loader@$PROJECT.iam.gserviceaccount.com",
+				"gcloud projects remove-iam-policy-binding $PROJECT --member=serviceAccount:temp@$PROJECT.iam.gserviceaccount.com --role roles/viewer",
+				"gcloud iam service-accounts delete temp@$PROJECT.iam.gserviceaccount.com"},
+		},
+		{
+			Filename:  "020_two.yaml",
+			DoSection: []string{"gcloud iam service-accounts delete temp@$PROJECT.iam.gserviceaccount.com"},
+		},
+	}
+	baseline, err := squashMigrations(undoRules, list)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := strings.Join(baseline.DoSection, ","), "# 010_one.yaml,"+
+		"# left out, uses removed temp: gcloud projects add-iam-policy-binding $PROJECT --member serviceAccount:temp@$PROJECT.iam.gserviceaccount.com --role roles/viewer,"+
+		"gcloud iam service-accounts create loader"; got != want {
+		t.Errorf("got [%v] want [%v]", got, want)
+	}
+	if got, want := strings.Join(baseline.UndoSection, ","), "# 010_one.yaml,gcloud iam service-accounts delete loader@$PROJECT.iam.gserviceaccount.com"; got != want {
+		t.Errorf("got [%v] want [%v]", got, want)
+	}
+}
+
+func TestSquashMigrationsWithCondition(t *testing.T) {
+	list := []Migration{{Filename: "010_one.yaml", IfExpression: "PROJECT == 'x'"}}
+	if _, err := squashMigrations(undoRules, list); err == nil {
+		t.Fatal("error expected")
+	}
+}
+
+func TestBaselineFilename(t *testing.T) {
+	for _, each := range []struct{ last, want string }{
+		{"300_add_user.yaml", "300_baseline.yaml"},
+		{"iam/20240102t150405_add_user.md", "iam/20240102t150405_baseline.yaml"},
+	} {
+		got, err := baselineFilename(each.last)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != each.want {
+			t.Errorf("got [%v] want [%v]", got, each.want)
+		}
+	}
+	if _, err := baselineFilename("add_user.yaml"); err == nil {
+		t.Fatal("error expected")
+	}
+}
+
+func TestApplySquash(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFiles(t, dir, "010_one.yaml", "020_two.yaml")
+	if err := os.WriteFile(filepath.Join(dir, "030_three.yaml"), []byte("requires:\n- 010_one.yaml\ndo:\n- echo three"), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	baseline := Migration{
+		Filename:    "020_baseline.yaml",
+		Description: "baseline",
+		DoSection:   []string{"# 010_one.yaml", "echo 010_one.yaml"},
+		UndoSection: []string{"echo undo"},
+		Squashed:    []string{"010_one.yaml", "020_two.yaml"},
+	}
+	if err := applySquash(dir, nil, baseline); err != nil {
+		t.Fatal(err)
+	}
+	after, _ := collectMigrationFiles(dir, []string{"."})
+	if got, want := strings.Join(after, ","), "020_baseline.yaml,030_three.yaml"; got != want {
+		t.Errorf("got [%v] want [%v]", got, want)
+	}
+	if err := checkExists(filepath.Join(dir, defaultArchiveFolder, "020_two.yaml")); err != nil {
+		t.Error(err)
+	}
+	written, err := LoadMigration(filepath.Join(dir, "020_baseline.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := strings.Join(written.DoSection, ","), "echo 010_one.yaml"; got != want {
+		t.Errorf("got [%v] want [%v]", got, want)
+	}
+	if got, want := strings.Join(written.Squashed, ","), "010_one.yaml,020_two.yaml"; got != want {
+		t.Errorf("got [%v] want [%v]", got, want)
+	}
+	three, _ := LoadMigration(filepath.Join(dir, "030_three.yaml"))
+	if got, want := strings.Join(three.Requires, ","), "020_baseline.yaml"; got != want {
+		t.Errorf("got [%v] want [%v]", got, want)
+	}
+	renames, _ := loadRenames(dir, Config{})
+	if got, want := renames["020_two.yaml"], "020_baseline.yaml"; got != want {
+		t.Errorf("got [%v] want [%v]", got, want)
+	}
+}
+
+func TestCheckNotInSquashed(t *testing.T) {
+	pending := []Migration{{Filename: "020_baseline.yaml", Squashed: []string{"010_one.yaml", "020_two.yaml"}}, {Filename: "030_three.yaml"}}
+	if err := checkNotInSquashed("010_one.yaml", pending); err == nil {
+		t.Error("error expected")
+	}
+	if err := checkNotInSquashed("archive/010_one.yaml", pending); err == nil {
+		t.Error("error expected")
+	}
+	if err := checkNotInSquashed("", pending); err != nil {
+		t.Error(err)
+	}
+	if err := checkNotInSquashed("005_zero.yaml", pending); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+// State holds what is stored in the state object of a target.
+type State struct {
+	// LastApplied is the filename of the last applied migration.
+	LastApplied string `yaml:"applied"`
+	// Outputs are the values captured from do sections, per migration filename.
+	Outputs map[string]map[string]string `yaml:"outputs,omitempty"`
+	// Skipped has the applied migrations, with |ITEM for a foreach item, of which the if_command has skipped the do section.
+	Skipped []string `yaml:"skipped,omitempty"`
+	// History has the sections of migrations that were run for the target, oldest first.
+	History []HistoryEntry `yaml:"history,omitempty"`
+}
+
+// HistoryEntry records that the do or undo section of a migration was run.
+type HistoryEntry struct {
+	Filename    string    `yaml:"filename" json:"filename"`
+	Section     string    `yaml:"section" json:"section"`
+	Time        time.Time `yaml:"time" json:"time"`
+	Description string    `yaml:"description,omitempty" json:"description,omitempty"`
+	Owner       string    `yaml:"owner,omitempty" json:"owner,omitempty"`
+	Ticket      string    `yaml:"ticket,omitempty" json:"ticket,omitempty"`
+}
+
+// newHistoryEntry returns an entry for running a section of the migration now.
+func newHistoryEntry(m Migration, section string) HistoryEntry {
+	return HistoryEntry{
+		Filename:    m.Filename,
+		Section:     section,
+		Time:        timeNow().UTC().Truncate(time.Second),
+		Description: m.Description,
+		Owner:       m.Owner,
+		Ticket:      m.Ticket,
+	}
+}
+
+// parseState reads the contents of a state object.
+// A state without outputs, skipped migrations and history is stored as the plain filename of the last applied migration
+// such that it remains readable by older versions of gmig.
+func parseState(data string) (State, error) {
+	if !strings.HasPrefix(data, "applied:") {
+		return State{LastApplied: strings.TrimSpace(data)}, nil
+	}
+	var s State
+	err := yaml.Unmarshal([]byte(data), &s)
+	return s, err
+}
+
+// String returns the contents for storing in a state object.
+func (s State) String() string {
+	if len(s.Outputs) == 0 && len(s.Skipped) == 0 && len(s.History) == 0 {
+		return s.LastApplied
+	}
+	data, _ := yaml.Marshal(s)
+	return string(data)
+}
+
+// outputEnv returns KEY=value pairs of all outputs, ordered by migration filename
+// such that outputs of later migrations override those of earlier ones.
+func (s State) outputEnv() (envs []string) {
+	filenames := []string{}
+	for each := range s.Outputs {
+		filenames = append(filenames, each)
+	}
+	sort.Strings(filenames)
+	for _, each := range filenames {
+		keys := []string{}
+		for k := range s.Outputs[each] {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			envs = append(envs, k+"="+s.Outputs[each][k])
+		}
+	}
+	return
+}
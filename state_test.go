@@ -0,0 +1,84 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestParseStatePlainFilename(t *testing.T) {
+	s, err := parseState("010_one.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := s.LastApplied, "010_one.yaml"; got != want {
+		t.Errorf("got [%v] want [%v]", got, want)
+	}
+	if got, want := s.String(), "010_one.yaml"; got != want {
+		t.Errorf("got [%v] want [%v]", got, want)
+	}
+}
+
+func TestParseStateWithOutputs(t *testing.T) {
+	s := State{LastApplied: "020_two.yaml", Outputs: map[string]map[string]string{
+		"010_one.yaml": {"STATIC_IP": "1.2.3.4", "NAME": "a=b"},
+		"020_two.yaml": {"NAME": "c"},
+	}}
+	back, err := parseState(s.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := back.LastApplied, "020_two.yaml"; got != want {
+		t.Errorf("got [%v] want [%v]", got, want)
+	}
+	envs := back.outputEnv()
+	if got, want := len(envs), 3; got != want {
+		t.Fatalf("got [%v] want [%v]", got, want)
+	}
+	// later migrations override earlier ones
+	if got, want := envs[2], "NAME=c"; got != want {
+		t.Errorf("got [%v] want [%v]", got, want)
+	}
+}
+
+func TestParseStateWithHistory(t *testing.T) {
+	timeNow = func() time.Time { return time.Date(2024, 3, 1, 12, 30, 45, 0, time.UTC) }
+	defer func() { timeNow = time.Now }()
+	m := Migration{Filename: "010_one.yaml", Description: "add loader\naccount", Owner: "platform", Ticket: "OPS-1"}
+	s := State{LastApplied: "010_one.yaml", History: []HistoryEntry{newHistoryEntry(m, "do")}}
+	back, err := parseState(s.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := back.LastApplied, "010_one.yaml"; got != want {
+		t.Errorf("got [%v] want [%v]", got, want)
+	}
+	if got, want := len(back.History), 1; got != want {
+		t.Fatalf("got [%v] want [%v]", got, want)
+	}
+	h := back.History[0]
+	if got, want := h.Time, timeNow(); !got.Equal(want) {
+		t.Errorf("got [%v] want [%v]", got, want)
+	}
+	if got, want := h.historyInfo(), " : add loader owner: platform ticket: OPS-1"; got != want {
+		t.Errorf("got [%v] want [%v]", got, want)
+	}
+}
+
+func TestReadOutputs(t *testing.T) {
+	f := filepath.Join(t.TempDir(), "outputs")
+	if err := os.WriteFile(f, []byte("# ip\nSTATIC_IP=1.2.3.4\n\nCONN=p:r:i=x\n"), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	outputs, err := readOutputs(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := outputs["STATIC_IP"], "1.2.3.4"; got != want {
+		t.Errorf("got [%v] want [%v]", got, want)
+	}
+	if got, want := outputs["CONN"], "p:r:i=x"; got != want {
+		t.Errorf("got [%v] want [%v]", got, want)
+	}
+}
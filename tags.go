@@ -0,0 +1,56 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/urfave/cli"
+)
+
+// tagFilter selects migrations by their tags.
+type tagFilter struct {
+	include []string
+	exclude []string
+}
+
+// newTagFilter returns the filter from the comma separated values of the tags and exclude-tags flags.
+func newTagFilter(c *cli.Context) tagFilter {
+	return tagFilter{
+		include: splitTags(c.String("tags")),
+		exclude: splitTags(c.String("exclude-tags")),
+	}
+}
+
+func splitTags(value string) (tags []string) {
+	for _, each := range strings.Split(value, ",") {
+		if t := strings.TrimSpace(each); len(t) > 0 {
+			tags = append(tags, t)
+		}
+	}
+	return
+}
+
+// isIncluded returns true if no tags are required or the migration has one of them.
+func (f tagFilter) isIncluded(m Migration) bool {
+	return len(f.include) == 0 || m.hasAnyTag(f.include)
+}
+
+// isExcluded returns true if the migration has one of the excluded tags.
+func (f tagFilter) isExcluded(m Migration) bool {
+	return m.hasAnyTag(f.exclude)
+}
+
+// accepts returns true if the migration is included and not excluded.
+func (f tagFilter) accepts(m Migration) bool {
+	return f.isIncluded(m) && !f.isExcluded(m)
+}
+
+func (m Migration) hasAnyTag(tags []string) bool {
+	for _, each := range m.Tags {
+		for _, other := range tags {
+			if each == other {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,22 @@
+package main
+
+import "testing"
+
+func TestTagFilter(t *testing.T) {
+	iam := Migration{Tags: []string{"iam"}}
+	expensive := Migration{Tags: []string{"expensive", "gke"}}
+	none := Migration{}
+	f := tagFilter{include: splitTags("iam, gke"), exclude: splitTags("expensive")}
+	if !f.accepts(iam) {
+		t.Error("iam should be accepted")
+	}
+	if f.accepts(expensive) {
+		t.Error("expensive should not be accepted")
+	}
+	if f.isIncluded(none) {
+		t.Error("untagged should not be included")
+	}
+	if !(tagFilter{}).accepts(none) {
+		t.Error("empty filter should accept all")
+	}
+}
@@ -0,0 +1,47 @@
+package main
+
+// Variant holds sections that replace those of a migration for a specific target.
+type Variant struct {
+	PrecheckSection []string `yaml:"precheck"`
+	DoSection       []string `yaml:"do"`
+	UndoSection     []string `yaml:"undo"`
+	ViewSection     []string `yaml:"view"`
+}
+
+// selectVariant returns the migration with the sections of the variant that matches the target or one of the labels.
+// A match on target name has precedence over labels ; labels are tried in order.
+// Sections that are absent in the variant are kept.
+func selectVariant(m Migration, target string, labels []string) Migration {
+	if len(m.Targets) == 0 {
+		return m
+	}
+	for _, each := range append([]string{target}, labels...) {
+		v, ok := m.Targets[each]
+		if !ok {
+			continue
+		}
+		m.variant = each
+		if v.PrecheckSection != nil {
+			m.PrecheckSection = v.PrecheckSection
+		}
+		if v.DoSection != nil {
+			m.DoSection = v.DoSection
+		}
+		if v.UndoSection != nil {
+			m.UndoSection = v.UndoSection
+		}
+		if v.ViewSection != nil {
+			m.ViewSection = v.ViewSection
+		}
+		return m
+	}
+	return m
+}
+
+// variantInfo returns a description of the selected variant for logging ; empty if the default applies.
+func (m Migration) variantInfo() string {
+	if len(m.variant) == 0 {
+		return ""
+	}
+	return " [variant: " + m.variant + "]"
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"testing"
+
+	"gopkg.in/yaml.v2"
+)
+
+var variants = `
+do:
+- echo default
+undo:
+- echo undo default
+targets:
+  prod:
+    do:
+    - echo prod
+  large:
+    do:
+    - echo large
+`
+
+func TestSelectVariant(t *testing.T) {
+	var m Migration
+	if err := yaml.Unmarshal([]byte(variants), &m); err != nil {
+		t.Fatal(err)
+	}
+	for _, each := range []struct {
+		target string
+		labels []string
+		do     string
+	}{
+		{"dev", nil, "echo default"},
+		{"prod", []string{"large"}, "echo prod"},
+		{"staging", []string{"small", "large"}, "echo large"},
+	} {
+		v := selectVariant(m, each.target, each.labels)
+		if got, want := v.DoSection[0], each.do; got != want {
+			t.Errorf("got [%v] want [%v]", got, want)
+		}
+		if got, want := v.UndoSection[0], "echo undo default"; got != want {
+			t.Errorf("got [%v] want [%v]", got, want)
+		}
+	}
+}